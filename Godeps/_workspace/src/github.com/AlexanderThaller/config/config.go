@@ -1,8 +1,6 @@
 package config
 
 import (
-	"bytes"
-	"encoding/json"
 	"io/ioutil"
 	"os"
 
@@ -38,16 +36,15 @@ func Configure(pa string, co Config) error {
 	return nil
 }
 
+// Load reads the config file at the given path. The format is detected by
+// the extension of the file, see Format.
 func Load(pa string, co Config) error {
 	i, err := ioutil.ReadFile(pa)
 	if err != nil {
 		return errgo.New(err.Error())
 	}
 
-	var b bytes.Buffer
-	json.Compact(&b, i)
-
-	err = json.Unmarshal(b.Bytes(), co)
+	err = Unmarshal(Format(pa), i, co)
 	if err != nil {
 		return errgo.New(err.Error())
 	}
@@ -55,12 +52,47 @@ func Load(pa string, co Config) error {
 	return nil
 }
 
+// Save writes the config to the given path in the format that matches the
+// extension of the file, see Format.
 func Save(pa string, co Config) error {
-	o, err := json.MarshalIndent(co, "", "  ")
+	o, err := Marshal(Format(pa), co)
+	if err != nil {
+		return errgo.New(err.Error())
+	}
+
+	err = ioutil.WriteFile(pa, o, 0644)
 	if err != nil {
 		return errgo.New(err.Error())
 	}
 
+	return nil
+}
+
+// Update writes the config to the given path like Save. Comments of an
+// existing toml or yaml file are kept so a program can change its config
+// without losing the notes of the user.
+func Update(pa string, co Config) error {
+	i, err := ioutil.ReadFile(pa)
+	if os.IsNotExist(err) {
+		return Save(pa, co)
+	}
+	if err != nil {
+		return errgo.New(err.Error())
+	}
+
+	f := Format(pa)
+	o, err := Marshal(f, co)
+	if err != nil {
+		return errgo.New(err.Error())
+	}
+
+	switch f {
+	case FormatTOML:
+		o = keepTOMLComments(i, o)
+	case FormatYAML:
+		o = keepYAMLComments(i, o)
+	}
+
 	err = ioutil.WriteFile(pa, o, 0644)
 	if err != nil {
 		return errgo.New(err.Error())
@@ -1 +1,278 @@
 package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testFilter struct {
+	Expression string
+	Field      string `json:",omitempty"`
+}
+
+type testFeed struct {
+	Url     string
+	Filters []interface{}
+	Paused  bool `json:",omitempty"`
+}
+
+type testConfig struct {
+	DataFolder string
+	Feeds      []testFeed
+	LogLevel   map[string]string
+	Port       uint16
+	Ratio      float64
+	Tags       []string
+	Nested     struct {
+		Mode  string
+		Count int
+	}
+}
+
+func (co *testConfig) Default() {
+	co.DataFolder = "feeds"
+	co.Feeds = []testFeed{
+		{Url: "https://example.com/feed?a=1&b=2", Filters: []interface{}{".*Talk:.*"}},
+		{Url: "https://example.com/other", Paused: true, Filters: []interface{}{
+			"first",
+			map[string]interface{}{"Expression": "/a/ and not /b/", "Field": "summary"},
+		}},
+	}
+	co.LogLevel = map[string]string{".": "Notice", "RssWatch.Feed": "Debug"}
+	co.Port = 5222
+	co.Ratio = 0.5
+	co.Tags = []string{"a \"quoted\" # tag", "line\nbreak", "tab\there", "üñí"}
+	co.Nested.Mode = "newest"
+	co.Nested.Count = 5
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	folder, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	expected := new(testConfig)
+	expected.Default()
+
+	for _, name := range []string{"config.json", "config.toml", "config.yaml", "config.yml"} {
+		pa := filepath.Join(folder, name)
+
+		err := Configure(pa, new(testConfig))
+		if err != nil {
+			t.Fatal(name, ": ", err)
+		}
+
+		loaded := new(testConfig)
+		err = Load(pa, loaded)
+		if err != nil {
+			data, _ := ioutil.ReadFile(pa)
+			t.Fatal(name, ": ", err, "\n", string(data))
+		}
+
+		if !reflect.DeepEqual(loaded, expected) {
+			data, _ := ioutil.ReadFile(pa)
+			t.Errorf("%s: round trip changed the config\n%+v\n%s", name, loaded, data)
+		}
+	}
+}
+
+func TestDecodeTOML(t *testing.T) {
+	input := `# The folder for the data
+DataFolder = 'feeds' # trailing comment
+Port = 5_222
+Ratio = 5e-1
+Tags = [
+  "one", # first
+  """two
+lines""",
+]
+LogLevel = { "." = "Notice" }
+Nested.Mode = "newest"
+Nested.Count = 5
+
+[[Feeds]]
+Url = "https://example.com/feed"
+Filters = ["a", { Expression = "b", Field = "title" }]
+
+[[Feeds]]
+Url = "https://example.com/other"
+Paused = true
+`
+
+	loaded := new(testConfig)
+	err := Unmarshal(FormatTOML, []byte(input), loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.DataFolder != "feeds" || loaded.Port != 5222 || loaded.Ratio != 0.5 ||
+		loaded.Nested.Mode != "newest" || loaded.Nested.Count != 5 ||
+		loaded.LogLevel["."] != "Notice" {
+		t.Errorf("wrong values: %+v", loaded)
+	}
+
+	if !reflect.DeepEqual(loaded.Tags, []string{"one", "two\nlines"}) {
+		t.Error("wrong tags: ", loaded.Tags)
+	}
+
+	if len(loaded.Feeds) != 2 || !loaded.Feeds[1].Paused || len(loaded.Feeds[0].Filters) != 2 {
+		t.Errorf("wrong feeds: %+v", loaded.Feeds)
+	}
+
+	for _, invalid := range []string{"Port = ", "Port = 1\nPort = 2", "[Feeds", "Tags = [1, 2", `A = "\q"`} {
+		err := Unmarshal(FormatTOML, []byte(invalid), new(testConfig))
+		if err == nil {
+			t.Error("expected an error for ", invalid)
+		}
+	}
+}
+
+func TestDecodeYAML(t *testing.T) {
+	input := `---
+# The folder for the data
+DataFolder: feeds # trailing comment
+Port: 5222
+Ratio: .5
+Tags: [one, "two # not a comment", 'it''s']
+LogLevel:
+  ".": Notice
+Nested: {Mode: newest, Count: 5}
+Feeds:
+- Url: https://example.com/feed
+  Filters:
+    - a
+    - Expression: |
+        /a/ and
+        not /b/
+      Field: title
+- Url: https://example.com/other
+  Paused: true
+  Filters: []
+`
+
+	loaded := new(testConfig)
+	err := Unmarshal(FormatYAML, []byte(input), loaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded.DataFolder != "feeds" || loaded.Port != 5222 || loaded.Ratio != 0.5 ||
+		loaded.Nested.Mode != "newest" || loaded.Nested.Count != 5 ||
+		loaded.LogLevel["."] != "Notice" {
+		t.Errorf("wrong values: %+v", loaded)
+	}
+
+	if !reflect.DeepEqual(loaded.Tags, []string{"one", "two # not a comment", "it's"}) {
+		t.Error("wrong tags: ", loaded.Tags)
+	}
+
+	if len(loaded.Feeds) != 2 || !loaded.Feeds[1].Paused || len(loaded.Feeds[0].Filters) != 2 {
+		t.Fatalf("wrong feeds: %+v", loaded.Feeds)
+	}
+
+	filter, ok := loaded.Feeds[0].Filters[1].(map[string]interface{})
+	if !ok || filter["Expression"] != "/a/ and\nnot /b/\n" || filter["Field"] != "title" {
+		t.Errorf("wrong filter: %#v", loaded.Feeds[0].Filters[1])
+	}
+
+	for _, invalid := range []string{"Port: [1, 2", "Port: 1\nPort: 2", "Port: 1\n  Ratio: 2"} {
+		err := Unmarshal(FormatYAML, []byte(invalid), new(testConfig))
+		if err == nil {
+			t.Error("expected an error for ", invalid)
+		}
+	}
+}
+
+func TestUpdateKeepsComments(t *testing.T) {
+	folder, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	files := map[string]string{
+		"config.toml": `# Where the data goes
+DataFolder = "feeds" # relative to the config
+Port = 5222
+
+# Noisy, remove it later
+[[Feeds]]
+Url = "https://example.com/feed"
+Filters = ["a"]
+
+# Only for go releases
+[[Feeds]]
+Url = "https://example.com/other"
+Filters = ["b"] # the b filter
+`,
+		"config.yaml": `# Where the data goes
+DataFolder: feeds # relative to the config
+Port: 5222
+Feeds:
+  # Noisy, remove it later
+  - Url: https://example.com/feed
+    Filters: [a]
+  # Only for go releases
+  - Url: https://example.com/other
+    Filters: [b] # the b filter
+`,
+	}
+
+	for name, input := range files {
+		pa := filepath.Join(folder, name)
+		err := ioutil.WriteFile(pa, []byte(input), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		co := new(testConfig)
+		err = Load(pa, co)
+		if err != nil {
+			t.Fatal(name, ": ", err)
+		}
+
+		co.Feeds = co.Feeds[1:]
+		co.Feeds[0].Paused = true
+		co.Port = 5223
+
+		err = Update(pa, co)
+		if err != nil {
+			t.Fatal(name, ": ", err)
+		}
+
+		data, _ := ioutil.ReadFile(pa)
+		output := string(data)
+		for _, expected := range []string{"# Where the data goes", "# relative to the config",
+			"# Only for go releases", "# the b filter", "5223"} {
+			if !strings.Contains(output, expected) {
+				t.Errorf("%s: expected %q in\n%s", name, expected, output)
+			}
+		}
+
+		if strings.Contains(output, "# Noisy") {
+			t.Errorf("%s: comment of the removed feed was kept\n%s", name, output)
+		}
+
+		updated := new(testConfig)
+		err = Load(pa, updated)
+		if err != nil || !reflect.DeepEqual(updated, co) {
+			t.Errorf("%s: can not load the updated config: %v\n%s", name, err, output)
+		}
+
+		if strings.Index(output, "# Only for go releases") > strings.Index(output, "other") {
+			t.Errorf("%s: comment is not in front of its feed\n%s", name, output)
+		}
+
+		for _, line := range strings.Split(output, "\n") {
+			if strings.Contains(line, "# the b filter") && !strings.Contains(line, "Filters") {
+				t.Errorf("%s: comment is not behind its key\n%s", name, output)
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/errgo"
+)
+
+const (
+	FormatJSON = "json"
+	FormatTOML = "toml"
+	FormatYAML = "yaml"
+)
+
+// Format returns the format of the config file at the given path based on
+// its extension. Files with unknown extensions are treated as json.
+func Format(pa string) string {
+	switch strings.ToLower(filepath.Ext(pa)) {
+	case ".toml":
+		return FormatTOML
+	case ".yaml", ".yml":
+		return FormatYAML
+	default:
+		return FormatJSON
+	}
+}
+
+// Marshal encodes the given value in the given format. Toml and yaml are
+// generated from the json encoding of the value so the json field names and
+// options are used for all formats.
+func Marshal(format string, va interface{}) ([]byte, error) {
+	if format == FormatJSON {
+		return json.MarshalIndent(va, "", "  ")
+	}
+
+	j, err := json.Marshal(va)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := fromJSON(j)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatTOML:
+		return encodeTOML(v)
+	case FormatYAML:
+		return encodeYAML(v)
+	default:
+		return nil, errgo.New("unknown config format " + format)
+	}
+}
+
+// Unmarshal decodes the given data in the given format into the value.
+func Unmarshal(format string, da []byte, va interface{}) error {
+	var j []byte
+	var err error
+
+	switch format {
+	case FormatJSON:
+		var b bytes.Buffer
+		json.Compact(&b, da)
+		return json.Unmarshal(b.Bytes(), va)
+	case FormatTOML:
+		j, err = decodeTOML(da)
+	case FormatYAML:
+		j, err = decodeYAML(da)
+	default:
+		return errgo.New("unknown config format " + format)
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(j, va)
+}
+
+// member is a key and its value in an object. Objects are kept as a list of
+// members so yaml keeps the order of the fields.
+type member struct {
+	key   string
+	value interface{}
+}
+
+type object []member
+
+func (o *object) set(key string, value interface{}) {
+	for i, m := range *o {
+		if m.key == key {
+			(*o)[i].value = value
+			return
+		}
+	}
+
+	*o = append(*o, member{key, value})
+}
+
+// fromJSON decodes json into objects, slices, strings, json numbers, bools
+// and nil.
+func fromJSON(da []byte) (interface{}, error) {
+	d := json.NewDecoder(bytes.NewReader(da))
+	d.UseNumber()
+
+	return decodeJSONValue(d)
+}
+
+func decodeJSONValue(d *json.Decoder) (interface{}, error) {
+	t, err := d.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t {
+	case json.Delim('{'):
+		o := &object{}
+		for d.More() {
+			k, err := d.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			v, err := decodeJSONValue(d)
+			if err != nil {
+				return nil, err
+			}
+
+			o.set(k.(string), v)
+		}
+
+		_, err = d.Token()
+		return o, err
+
+	case json.Delim('['):
+		a := []interface{}{}
+		for d.More() {
+			v, err := decodeJSONValue(d)
+			if err != nil {
+				return nil, err
+			}
+
+			a = append(a, v)
+		}
+
+		_, err = d.Token()
+		return a, err
+
+	default:
+		return t, nil
+	}
+}
@@ -0,0 +1,371 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/juju/errgo"
+)
+
+func decodeTOML(da []byte) ([]byte, error) {
+	var v map[string]interface{}
+	_, err := toml.Decode(string(da), &v)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(v)
+}
+
+// encodeTOML writes the given object as a toml document. Nil values are left
+// out as toml has no null.
+func encodeTOML(va interface{}) ([]byte, error) {
+	o, ok := va.(*object)
+	if !ok {
+		return nil, errgo.New("toml can only encode objects")
+	}
+
+	var b bytes.Buffer
+	e := toml.NewEncoder(&b)
+	e.Indent = ""
+
+	err := e.Encode(tomlValue(o))
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// tomlValue converts the values returned by fromJSON to values the toml
+// encoder understands.
+func tomlValue(va interface{}) interface{} {
+	switch v := va.(type) {
+	case *object:
+		m := make(map[string]interface{})
+		for _, e := range *v {
+			if e.value != nil {
+				m[e.key] = tomlValue(e.value)
+			}
+		}
+
+		return m
+
+	case []interface{}:
+		a := []interface{}{}
+		for _, e := range v {
+			if e != nil {
+				a = append(a, tomlValue(e))
+			}
+		}
+
+		return a
+
+	case json.Number:
+		i, err := v.Int64()
+		if err == nil {
+			return i
+		}
+
+		f, _ := v.Float64()
+		return f
+
+	default:
+		return v
+	}
+}
+
+// keepTOMLComments adds the comments of the old document to the tables and
+// keys of the updated one. Tables in arrays are matched by the keys they share
+// so the comments stay with their table if other tables are added or
+// removed.
+func keepTOMLComments(old, updated []byte) []byte {
+	o := parseTOMLTables(string(old))
+	if !o.hasComments() {
+		return updated
+	}
+
+	n := parseTOMLTables(string(updated))
+	n.keepComments(o)
+
+	var b bytes.Buffer
+	n.write(&b)
+
+	return b.Bytes()
+}
+
+// tomlLine is a key with its value or a table header together with the
+// comments in front of it and the comment at its end.
+type tomlLine struct {
+	key      string
+	text     string
+	comments []string
+	comment  string
+}
+
+// tomlTable is a table of a toml document with its keys and the tables
+// below it. The root table has no header.
+type tomlTable struct {
+	header tomlLine
+	path   string
+	keys   []*tomlLine
+	tables []*tomlTable
+	foot   []string
+}
+
+// parseTOMLTables splits a toml document into its tables. The document is
+// not validated, it only has to be good enough to find keys and comments.
+func parseTOMLTables(input string) *tomlTable {
+	root := &tomlTable{}
+	stack := []*tomlTable{root}
+	var comments []string
+
+	lines := strings.Split(input, "\n")
+	for i := 0; i < len(lines); i++ {
+		text := strings.TrimSpace(lines[i])
+		if text == "" {
+			continue
+		}
+
+		if strings.HasPrefix(text, "#") {
+			comments = append(comments, text)
+			continue
+		}
+
+		var code, comment string
+		i, code, comment = scanTOMLStatement(lines, i)
+		line := &tomlLine{text: code, comments: comments, comment: comment}
+		comments = nil
+
+		if !strings.HasPrefix(code, "[") {
+			line.key = strings.TrimSpace(strings.SplitN(code, "=", 2)[0])
+			top := stack[len(stack)-1]
+			top.keys = append(top.keys, line)
+			continue
+		}
+
+		table := &tomlTable{header: *line, path: strings.Trim(code, "[] \t")}
+		table.header.text = "[" + table.path + "]"
+		if strings.HasPrefix(code, "[[") {
+			table.header.text = "[" + table.header.text + "]"
+		}
+
+		for len(stack) > 1 && !strings.HasPrefix(table.path, stack[len(stack)-1].path+".") {
+			stack = stack[:len(stack)-1]
+		}
+
+		top := stack[len(stack)-1]
+		top.tables = append(top.tables, table)
+		stack = append(stack, table)
+	}
+
+	root.foot = comments
+	return root
+}
+
+// scanTOMLStatement reads the key or table header that starts at the given
+// line. Values can span several lines, the index of the last line is
+// returned together with the statement without comments and the comment at
+// its end.
+func scanTOMLStatement(lines []string, start int) (int, string, string) {
+	var code []string
+	var comment string
+	var multiline string
+	depth := 0
+
+	for i := start; i < len(lines); i++ {
+		line := lines[i]
+		end := len(line)
+		comment = ""
+		quote := byte(0)
+
+	scan:
+		for j := 0; j < len(line); j++ {
+			switch {
+			case multiline != "":
+				if strings.HasPrefix(line[j:], multiline) {
+					j += 2
+					multiline = ""
+				} else if line[j] == '\\' && multiline == `"""` {
+					j++
+				}
+
+			case quote != 0:
+				if line[j] == '\\' && quote == '"' {
+					j++
+				} else if line[j] == quote {
+					quote = 0
+				}
+
+			case strings.HasPrefix(line[j:], `"""`), strings.HasPrefix(line[j:], "'''"):
+				multiline = line[j : j+3]
+				j += 2
+
+			case line[j] == '"', line[j] == '\'':
+				quote = line[j]
+
+			case line[j] == '[', line[j] == '{':
+				depth++
+
+			case line[j] == ']', line[j] == '}':
+				depth--
+
+			case line[j] == '#':
+				end = j
+				comment = strings.TrimSpace(line[j:])
+				break scan
+			}
+		}
+
+		code = append(code, strings.TrimRight(line[:end], " \t"))
+		if depth <= 0 && multiline == "" {
+			return i, strings.TrimSpace(strings.Join(code, "\n")), comment
+		}
+	}
+
+	return len(lines) - 1, strings.TrimSpace(strings.Join(code, "\n")), comment
+}
+
+func (table *tomlTable) hasComments() bool {
+	if len(table.header.comments) != 0 || table.header.comment != "" || len(table.foot) != 0 {
+		return true
+	}
+
+	for _, key := range table.keys {
+		if len(key.comments) != 0 || key.comment != "" {
+			return true
+		}
+	}
+
+	for _, child := range table.tables {
+		if child.hasComments() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// keepComments copies the comments of the old table and its keys and
+// continues with the tables below it.
+func (table *tomlTable) keepComments(old *tomlTable) {
+	table.header.comments = old.header.comments
+	table.header.comment = old.header.comment
+	table.foot = old.foot
+
+	for _, key := range table.keys {
+		for _, oldKey := range old.keys {
+			if key.key == oldKey.key {
+				key.comments = oldKey.comments
+				key.comment = oldKey.comment
+				break
+			}
+		}
+	}
+
+	used := make(map[*tomlTable]bool)
+	for i, child := range table.tables {
+		match := child.match(old.tables, used)
+		if match == nil {
+			match = child.sameIndex(i, table.tables, old.tables, used)
+		}
+
+		if match != nil {
+			used[match] = true
+			child.keepComments(match)
+		}
+	}
+}
+
+// match returns the unused table with the same header that shares the most
+// keys and values with the table.
+func (table *tomlTable) match(tables []*tomlTable, used map[*tomlTable]bool) *tomlTable {
+	var best *tomlTable
+	var bestShared int
+
+	for _, other := range tables {
+		if used[other] || other.header.text != table.header.text {
+			continue
+		}
+
+		var shared int
+		for _, key := range table.keys {
+			for _, otherKey := range other.keys {
+				if key.text == otherKey.text {
+					shared++
+				}
+			}
+		}
+
+		if shared > bestShared {
+			best = other
+			bestShared = shared
+		}
+	}
+
+	return best
+}
+
+// sameIndex returns the table at the same position among the tables with
+// the same header if the number of those tables did not change.
+func (table *tomlTable) sameIndex(i int, tables, old []*tomlTable, used map[*tomlTable]bool) *tomlTable {
+	var index int
+	var count int
+	for j, other := range tables {
+		if other.header.text == table.header.text {
+			if j < i {
+				index++
+			}
+			count++
+		}
+	}
+
+	var same []*tomlTable
+	for _, other := range old {
+		if other.header.text == table.header.text {
+			same = append(same, other)
+		}
+	}
+
+	if len(same) != count || used[same[index]] {
+		return nil
+	}
+
+	return same[index]
+}
+
+func (table *tomlTable) write(b *bytes.Buffer) {
+	if table.header.text != "" {
+		if b.Len() != 0 {
+			b.WriteString("\n")
+		}
+
+		table.header.write(b)
+	}
+
+	for _, key := range table.keys {
+		key.write(b)
+	}
+
+	for _, child := range table.tables {
+		child.write(b)
+	}
+
+	if len(table.foot) != 0 {
+		b.WriteString("\n" + strings.Join(table.foot, "\n") + "\n")
+	}
+}
+
+func (line *tomlLine) write(b *bytes.Buffer) {
+	for _, comment := range line.comments {
+		b.WriteString(comment + "\n")
+	}
+
+	b.WriteString(line.text)
+	if line.comment != "" {
+		b.WriteString(" " + line.comment)
+	}
+	b.WriteString("\n")
+}
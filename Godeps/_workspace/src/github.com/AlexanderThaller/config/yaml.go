@@ -0,0 +1,197 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"gopkg.in/yaml.v3"
+)
+
+func decodeYAML(da []byte) ([]byte, error) {
+	var v interface{}
+	err := yaml.Unmarshal(da, &v)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(v)
+}
+
+// encodeYAML writes the given value as a yaml document. The fields keep the
+// order of the json encoding.
+func encodeYAML(va interface{}) ([]byte, error) {
+	return writeYAML(&yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{yamlNode(va)}})
+}
+
+func writeYAML(node *yaml.Node) ([]byte, error) {
+	var b bytes.Buffer
+	e := yaml.NewEncoder(&b)
+	e.SetIndent(2)
+
+	err := e.Encode(node)
+	if err != nil {
+		return nil, err
+	}
+
+	err = e.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// yamlNode converts the values returned by fromJSON to yaml nodes.
+func yamlNode(va interface{}) *yaml.Node {
+	switch v := va.(type) {
+	case *object:
+		n := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, m := range *v {
+			n.Content = append(n.Content, yamlScalar("!!str", m.key), yamlNode(m.value))
+		}
+
+		return n
+
+	case []interface{}:
+		n := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, e := range v {
+			n.Content = append(n.Content, yamlNode(e))
+		}
+
+		return n
+
+	case string:
+		return yamlScalar("!!str", v)
+
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return yamlScalar("!!int", v.String())
+		}
+
+		return yamlScalar("!!float", v.String())
+
+	case bool:
+		if v {
+			return yamlScalar("!!bool", "true")
+		}
+
+		return yamlScalar("!!bool", "false")
+
+	default:
+		return yamlScalar("!!null", "null")
+	}
+}
+
+func yamlScalar(tag, value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
+
+// keepYAMLComments adds the comments of the old document to the keys and
+// values of the updated one. Items of sequences are matched by the values
+// they share so the comments stay with their item if other items are added
+// or removed.
+func keepYAMLComments(old, updated []byte) []byte {
+	var o, n yaml.Node
+	if yaml.Unmarshal(old, &o) != nil || yaml.Unmarshal(updated, &n) != nil {
+		return updated
+	}
+
+	keepYAMLNodeComments(&o, &n)
+
+	out, err := writeYAML(&n)
+	if err != nil {
+		return updated
+	}
+
+	return out
+}
+
+func keepYAMLNodeComments(old, node *yaml.Node) {
+	node.HeadComment = old.HeadComment
+	node.LineComment = old.LineComment
+	node.FootComment = old.FootComment
+
+	if old.Kind != node.Kind {
+		return
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(old.Content) != 0 && len(node.Content) != 0 {
+			keepYAMLNodeComments(old.Content[0], node.Content[0])
+		}
+
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			for j := 0; j+1 < len(old.Content); j += 2 {
+				if node.Content[i].Value == old.Content[j].Value {
+					key, value := node.Content[i], node.Content[i+1]
+					keepYAMLNodeComments(old.Content[j], key)
+					keepYAMLNodeComments(old.Content[j+1], value)
+
+					// Block collections start on the next line so the comment
+					// behind a flow collection has to move to the key.
+					if value.Kind != yaml.ScalarNode && value.LineComment != "" {
+						key.LineComment = value.LineComment
+						value.LineComment = ""
+					}
+					break
+				}
+			}
+		}
+
+	case yaml.SequenceNode:
+		used := make(map[*yaml.Node]bool)
+		for i, item := range node.Content {
+			match := yamlMatch(item, old.Content, used)
+			if match == nil && len(old.Content) == len(node.Content) && !used[old.Content[i]] {
+				match = old.Content[i]
+			}
+
+			if match != nil {
+				used[match] = true
+				keepYAMLNodeComments(match, item)
+			}
+		}
+	}
+}
+
+// yamlMatch returns the unused node that shares the most scalar values with
+// the given node.
+func yamlMatch(node *yaml.Node, nodes []*yaml.Node, used map[*yaml.Node]bool) *yaml.Node {
+	var best *yaml.Node
+	var bestShared int
+
+	for _, other := range nodes {
+		if used[other] || other.Kind != node.Kind {
+			continue
+		}
+
+		var shared int
+		switch node.Kind {
+		case yaml.ScalarNode:
+			if node.Value == other.Value {
+				shared = 1
+			}
+
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				for j := 0; j+1 < len(other.Content); j += 2 {
+					key, value := node.Content[i], node.Content[i+1]
+					otherKey, otherValue := other.Content[j], other.Content[j+1]
+					if key.Value == otherKey.Value && value.Kind == yaml.ScalarNode &&
+						otherValue.Kind == yaml.ScalarNode && value.Value == otherValue.Value {
+						shared++
+					}
+				}
+			}
+		}
+
+		if shared > bestShared {
+			best = other
+			bestShared = shared
+		}
+	}
+
+	return best
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/xml"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -16,12 +17,18 @@ func parseAtom(data []byte, read *db) (*Feed, error) {
 		return nil, err
 	}
 
+	extensions := atomExtensions{}
+	err = decodeExtensions(data, &extensions)
+	if err != nil {
+		return nil, err
+	}
+
 	out := new(Feed)
 	out.Title = feed.Title
 	out.Description = feed.Description
 	out.Link = feed.Link.Href
 	out.Image = feed.Image.Image()
-	out.Refresh = time.Now().Add(10 * time.Minute)
+	out.Refresh = time.Now().Add(DefaultRefresh)
 
 	if feed.Items == nil {
 		return nil, fmt.Errorf("Error: no feeds found in %q.", string(data))
@@ -31,7 +38,7 @@ func parseAtom(data []byte, read *db) (*Feed, error) {
 	out.ItemMap = make(map[string]struct{})
 
 	// Process items.
-	for _, item := range feed.Items {
+	for i, item := range feed.Items {
 
 		// Skip items already known.
 		if read.req <- item.ID; <-read.res {
@@ -40,15 +47,45 @@ func parseAtom(data []byte, read *db) (*Feed, error) {
 
 		next := new(Item)
 		next.Title = item.Title
-		next.Summary = item.Summary
-		next.Content = item.Content
-		next.Link = item.Link.Href
+		next.Summary = item.Summary.text("", atomNamespace)
+		next.Content = item.Content.text("", atomNamespace)
+		for _, link := range item.Links {
+			switch link.Rel {
+			case "", "alternate":
+				if next.Link == "" {
+					next.Link = link.Href
+				}
+			case "enclosure":
+				next.addEnclosure(link.Href, link.Type, link.Length)
+			}
+		}
+		if next.Link == "" && len(item.Links) != 0 {
+			next.Link = item.Links[0].Href
+		}
+		next.Author = atomAuthors(item.Authors)
+		if next.Author == "" {
+			next.Author = atomAuthors(feed.Authors)
+		}
+		for _, category := range item.Categories {
+			if !inNamespace(category.XMLName, "", atomNamespace) {
+				continue
+			}
+
+			if category.Term != "" {
+				next.Categories = append(next.Categories, category.Term)
+			} else if category.Label != "" {
+				next.Categories = append(next.Categories, category.Label)
+			}
+		}
 		if item.Date != "" {
 			next.Date, err = parseTime(item.Date)
 			if err != nil {
 				return nil, err
 			}
 		}
+		if i < len(extensions.Items) {
+			next.addExtensions(extensions.Items[i])
+		}
 		next.ID = item.ID
 		next.Read = false
 
@@ -71,23 +108,36 @@ func parseAtom(data []byte, read *db) (*Feed, error) {
 }
 
 type atomFeed struct {
-	XMLName     xml.Name   `xml:"feed"`
-	Title       string     `xml:"title"`
-	Description string     `xml:"subtitle"`
-	Link        atomLink   `xml:"link"`
-	Image       atomImage  `xml:"image"`
-	Items       []atomItem `xml:"entry"`
-	Updated     string     `xml:"updated"`
+	XMLName     xml.Name     `xml:"feed"`
+	Title       string       `xml:"title"`
+	Description string       `xml:"subtitle"`
+	Link        atomLink     `xml:"link"`
+	Image       atomImage    `xml:"image"`
+	Items       []atomItem   `xml:"entry"`
+	Updated     string       `xml:"updated"`
+	Authors     []atomAuthor `xml:"author"`
 }
 
 type atomItem struct {
-	XMLName xml.Name `xml:"entry"`
-	Title   string   `xml:"title"`
-	Summary string   `xml:"summary"`
-	Content string   `xml:"content"`
-	Link    atomLink `xml:"link"`
-	Date    string   `xml:"updated"`
-	ID      string   `xml:"id"`
+	XMLName    xml.Name       `xml:"entry"`
+	Title      string         `xml:"title"`
+	Summary    xmlElements    `xml:"summary"`
+	Content    xmlElements    `xml:"content"`
+	Links      []atomLink     `xml:"link"`
+	Date       string         `xml:"updated"`
+	ID         string         `xml:"id"`
+	Authors    []atomAuthor   `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	XMLName xml.Name
+	Term    string `xml:"term,attr"`
+	Label   string `xml:"label,attr"`
 }
 
 type atomImage struct {
@@ -99,7 +149,21 @@ type atomImage struct {
 }
 
 type atomLink struct {
-	Href string `xml:"href,attr"`
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+func atomAuthors(authors []atomAuthor) string {
+	var names []string
+	for _, author := range authors {
+		if name := strings.TrimSpace(author.Name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return strings.Join(names, ", ")
 }
 
 func (a *atomImage) Image() *Image {
@@ -0,0 +1,51 @@
+package rss
+
+import "encoding/xml"
+
+// atomNamespace is the namespace of the elements of an Atom feed. Plain RSS
+// 2.0 elements have no namespace.
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+// xmlElement is an element with its name and text. Extensions like media or
+// itunes use the same local names as the plain elements of the feeds, the
+// name tells them apart.
+type xmlElement struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+type xmlElements []xmlElement
+
+// text returns the text of the last element in one of the given namespaces
+// like a plain string field would.
+func (elements xmlElements) text(spaces ...string) string {
+	values := elements.texts(spaces...)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[len(values)-1]
+}
+
+// texts returns the texts of the elements in one of the given namespaces.
+func (elements xmlElements) texts(spaces ...string) []string {
+	var values []string
+	for _, element := range elements {
+		if inNamespace(element.XMLName, spaces...) {
+			values = append(values, element.Value)
+		}
+	}
+
+	return values
+}
+
+// inNamespace returns true if the name is in one of the given namespaces.
+func inNamespace(name xml.Name, spaces ...string) bool {
+	for _, space := range spaces {
+		if name.Space == space {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,185 @@
+package rss
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Enclosure is a file attached to an item like the audio file of a podcast
+// episode. Length is the size in bytes and 0 if it is not known.
+type Enclosure struct {
+	URL    string
+	Type   string
+	Length int64
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+// mediaContent is a media:content element of Media RSS.
+type mediaContent struct {
+	URL      string `xml:"url,attr"`
+	Type     string `xml:"type,attr"`
+	FileSize string `xml:"fileSize,attr"`
+	Duration string `xml:"duration,attr"`
+}
+
+type mediaThumbnail struct {
+	URL string `xml:"url,attr"`
+}
+
+// itemExtensions are the Media RSS and itunes elements of an item. They are
+// decoded on their own as their names clash with the plain elements of the
+// item.
+type itemExtensions struct {
+	mediaGroup
+	MediaGroups    []mediaGroup `xml:"http://search.yahoo.com/mrss/ group"`
+	ItunesAuthor   string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd author"`
+	ItunesDuration string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	ItunesImage    itunesImage  `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+	ItunesSubtitle string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd subtitle"`
+	ItunesSummary  string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd summary"`
+	ItunesKeywords string       `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd keywords"`
+}
+
+// mediaGroup holds the media elements of an item. They can be given directly
+// in the item or grouped in a media:group element.
+type mediaGroup struct {
+	Contents    []mediaContent   `xml:"http://search.yahoo.com/mrss/ content"`
+	Thumbnails  []mediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+	Description string           `xml:"http://search.yahoo.com/mrss/ description"`
+	Keywords    string           `xml:"http://search.yahoo.com/mrss/ keywords"`
+}
+
+type itunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+// addEnclosure appends the enclosure unless an enclosure with the same url
+// was already added.
+func (i *Item) addEnclosure(url, kind, length string) {
+	url = strings.TrimSpace(url)
+	if url == "" {
+		return
+	}
+
+	for _, enclosure := range i.Enclosures {
+		if enclosure.URL == url {
+			return
+		}
+	}
+
+	size, _ := strconv.ParseInt(strings.TrimSpace(length), 10, 64)
+	i.Enclosures = append(i.Enclosures, Enclosure{URL: url, Type: kind, Length: size})
+}
+
+// addExtensions takes over the media and itunes elements for the fields of
+// the item that are not set already.
+func (i *Item) addExtensions(extensions itemExtensions) {
+	for _, group := range append([]mediaGroup{extensions.mediaGroup}, extensions.MediaGroups...) {
+		for _, content := range group.Contents {
+			i.addEnclosure(content.URL, content.Type, content.FileSize)
+			if i.Duration == 0 {
+				i.Duration = parseDuration(content.Duration)
+			}
+		}
+
+		for _, thumbnail := range group.Thumbnails {
+			if i.Image == "" {
+				i.Image = strings.TrimSpace(thumbnail.URL)
+			}
+		}
+
+		if i.Summary == "" {
+			i.Summary = strings.TrimSpace(group.Description)
+		}
+
+		i.addKeywords(group.Keywords)
+	}
+
+	if i.Author == "" {
+		i.Author = strings.TrimSpace(extensions.ItunesAuthor)
+	}
+
+	if i.Duration == 0 {
+		i.Duration = parseDuration(extensions.ItunesDuration)
+	}
+
+	if i.Image == "" {
+		i.Image = strings.TrimSpace(extensions.ItunesImage.Href)
+	}
+
+	if i.Summary == "" {
+		i.Summary = strings.TrimSpace(extensions.ItunesSummary)
+	}
+	if i.Summary == "" {
+		i.Summary = strings.TrimSpace(extensions.ItunesSubtitle)
+	}
+
+	i.addKeywords(extensions.ItunesKeywords)
+}
+
+// addKeywords adds the comma separated keywords to the categories.
+func (i *Item) addKeywords(keywords string) {
+	for _, keyword := range strings.Split(keywords, ",") {
+		keyword = strings.TrimSpace(keyword)
+		if keyword == "" {
+			continue
+		}
+
+		known := false
+		for _, category := range i.Categories {
+			if category == keyword {
+				known = true
+				break
+			}
+		}
+
+		if !known {
+			i.Categories = append(i.Categories, keyword)
+		}
+	}
+}
+
+// parseDuration reads durations given as seconds or as [[hh:]mm:]ss. It
+// returns 0 for durations it can not read.
+func parseDuration(value string) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	var seconds float64
+	for _, part := range strings.Split(value, ":") {
+		number, err := strconv.ParseFloat(part, 64)
+		if err != nil || number < 0 {
+			return 0
+		}
+
+		seconds = seconds*60 + number
+	}
+
+	return time.Duration(seconds * float64(time.Second))
+}
+
+type rss2_0Extensions struct {
+	Items []itemExtensions `xml:"channel>item"`
+}
+
+type atomExtensions struct {
+	Items []itemExtensions `xml:"entry"`
+}
+
+// decodeExtensions decodes the data a second time into one of the extension
+// types above.
+func decodeExtensions(data []byte, extensions interface{}) error {
+	p := xml.NewDecoder(bytes.NewReader(data))
+	p.CharsetReader = charsetReader
+	return p.Decode(extensions)
+}
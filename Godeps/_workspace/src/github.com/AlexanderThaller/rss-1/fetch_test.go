@@ -0,0 +1,84 @@
+package rss
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFetchConditional(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/rss_2.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		if r.Header.Get("If-None-Match") == `"v1"` &&
+			r.Header.Get("If-Modified-Since") == "Sat, 01 Jan 2000 00:00:00 GMT" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		if r.Header.Get("Accept-Encoding") != "gzip, deflate" {
+			t.Error("Accept-Encoding was not sent")
+		}
+
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Sat, 01 Jan 2000 00:00:00 GMT")
+		w.Header().Set("Content-Encoding", "gzip")
+
+		writer := gzip.NewWriter(w)
+		writer.Write(data)
+		writer.Close()
+	}))
+	defer server.Close()
+
+	feed, err := Fetch(server.URL)
+	if err != nil {
+		t.Fatal("Can not fetch gzip compressed feed: ", err)
+	}
+
+	if feed.ETag != `"v1"` || feed.LastModified != "Sat, 01 Jan 2000 00:00:00 GMT" {
+		t.Error("Validators were not stored: ", feed.ETag, ", ", feed.LastModified)
+	}
+
+	feed.Refresh = feed.Refresh.AddDate(-1, 0, 0)
+	updated, err := feed.Update()
+	if err != nil {
+		t.Fatal("Can not update feed: ", err)
+	}
+
+	if updated {
+		t.Error("Feed should not be updated when the server answers with 304")
+	}
+
+	if requests != 2 {
+		t.Error("Expected 2 requests but got ", requests)
+	}
+}
+
+func TestFetchJSONFeed(t *testing.T) {
+	defer CacheParsedItemIDs(CacheParsedItemIDs(false))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/feed+json")
+		w.Write([]byte(`
+{"version": "https://jsonfeed.org/version/1.1", "title": "JSON",
+"items": [{"id": "fetch-json", "content_text": "Not <rss version=\"2.0\">"}]}`))
+	}))
+	defer server.Close()
+
+	feed, err := Fetch(server.URL)
+	if err != nil {
+		t.Fatal("Can not fetch JSON Feed: ", err)
+	}
+
+	if feed.Title != "JSON" || len(feed.Items) != 1 || feed.Link != server.URL {
+		t.Error("Got wrong feed: ", feed)
+	}
+}
@@ -0,0 +1,222 @@
+package rss
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isJSONFeed reports whether the data is a JSON Feed. Data served as
+// application/feed+json always is, other json has to name a JSON Feed
+// version.
+func isJSONFeed(data []byte, contentType string) bool {
+	kind, _, err := mime.ParseMediaType(contentType)
+	if err == nil && kind == "application/feed+json" {
+		return true
+	}
+
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return false
+	}
+
+	var feed struct {
+		Version string `json:"version"`
+	}
+	if json.Unmarshal(data, &feed) != nil {
+		return false
+	}
+
+	return isJSONFeedVersion(feed.Version)
+}
+
+func isJSONFeedVersion(version string) bool {
+	return strings.HasPrefix(version, "https://jsonfeed.org/version/")
+}
+
+func parseJSONFeed(data []byte, read *db) (*Feed, error) {
+	feed := jsonFeed{}
+	err := json.Unmarshal(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")), &feed)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isJSONFeedVersion(feed.Version) {
+		return nil, fmt.Errorf("Error: unknown JSON Feed version %q.", feed.Version)
+	}
+
+	out := new(Feed)
+	out.Title = feed.Title
+	out.Description = feed.Description
+	out.Link = feed.HomePageURL
+	out.Image = &Image{Title: feed.Title, Url: feed.Icon}
+	out.Refresh = time.Now().Add(DefaultRefresh)
+
+	if feed.Items == nil {
+		return nil, fmt.Errorf("Error: no feeds found in %q.", string(data))
+	}
+
+	out.Items = make([]*Item, 0, len(feed.Items))
+	out.ItemMap = make(map[string]struct{})
+
+	// Process items.
+	for _, item := range feed.Items {
+
+		if item.ID == "" {
+			if item.URL == "" {
+				fmt.Printf("Warning: Item %q has no ID or url and will be ignored.\n", item.Title)
+				continue
+			}
+			item.ID = jsonFeedID(item.URL)
+		}
+
+		// Skip items already known.
+		if read.req <- string(item.ID); <-read.res {
+			continue
+		}
+
+		next := new(Item)
+		next.Title = item.Title
+		next.Summary = item.Summary
+		next.Content = item.ContentHTML
+		if next.Content == "" {
+			next.Content = item.ContentText
+		}
+		next.Link = item.URL
+		if next.Link == "" {
+			next.Link = item.ExternalURL
+		}
+		next.Author = jsonFeedAuthors(item.Authors, item.Author)
+		if next.Author == "" {
+			next.Author = jsonFeedAuthors(feed.Authors, feed.Author)
+		}
+		for _, tag := range item.Tags {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				next.Categories = append(next.Categories, tag)
+			}
+		}
+		for _, attachment := range item.Attachments {
+			next.addEnclosure(attachment.URL, attachment.MimeType,
+				strconv.FormatInt(attachment.SizeInBytes, 10))
+			if next.Duration == 0 {
+				next.Duration = time.Duration(attachment.DurationInSeconds * float64(time.Second))
+			}
+		}
+		next.Image = item.Image
+		if next.Image == "" {
+			next.Image = item.BannerImage
+		}
+		date := item.DatePublished
+		if date == "" {
+			date = item.DateModified
+		}
+		if date != "" {
+			next.Date, err = parseTime(date)
+			if err != nil {
+				return nil, err
+			}
+		}
+		next.ID = string(item.ID)
+		next.Read = false
+
+		if _, ok := out.ItemMap[next.ID]; ok {
+			fmt.Printf("Warning: Item %q has duplicate ID.\n", next.Title)
+			continue
+		}
+
+		out.Items = append(out.Items, next)
+		out.ItemMap[next.ID] = struct{}{}
+		out.Unread++
+	}
+
+	return out, nil
+}
+
+// jsonFeed covers version 1.0 and 1.1 of JSON Feed. Version 1.1 replaced
+// author with authors, both are read.
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	Description string           `json:"description"`
+	Icon        string           `json:"icon"`
+	Author      *jsonFeedAuthor  `json:"author"`
+	Authors     []jsonFeedAuthor `json:"authors"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            jsonFeedID           `json:"id"`
+	URL           string               `json:"url"`
+	ExternalURL   string               `json:"external_url"`
+	Title         string               `json:"title"`
+	ContentHTML   string               `json:"content_html"`
+	ContentText   string               `json:"content_text"`
+	Summary       string               `json:"summary"`
+	Image         string               `json:"image"`
+	BannerImage   string               `json:"banner_image"`
+	DatePublished string               `json:"date_published"`
+	DateModified  string               `json:"date_modified"`
+	Author        *jsonFeedAuthor      `json:"author"`
+	Authors       []jsonFeedAuthor     `json:"authors"`
+	Tags          []string             `json:"tags"`
+	Attachments   []jsonFeedAttachment `json:"attachments"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedAttachment struct {
+	URL               string  `json:"url"`
+	MimeType          string  `json:"mime_type"`
+	SizeInBytes       int64   `json:"size_in_bytes"`
+	DurationInSeconds float64 `json:"duration_in_seconds"`
+}
+
+// jsonFeedID is the id of an item. The specification asks readers to accept
+// numbers as well and to treat them as strings.
+type jsonFeedID string
+
+func (id *jsonFeedID) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	err := decoder.Decode(&value)
+	if err != nil {
+		return err
+	}
+
+	switch value := value.(type) {
+	case string:
+		*id = jsonFeedID(value)
+	case json.Number:
+		*id = jsonFeedID(value.String())
+	case nil:
+		*id = ""
+	default:
+		return fmt.Errorf("Error: item id %s is not a string.", string(data))
+	}
+
+	return nil
+}
+
+func jsonFeedAuthors(authors []jsonFeedAuthor, author *jsonFeedAuthor) string {
+	if len(authors) == 0 && author != nil {
+		authors = []jsonFeedAuthor{*author}
+	}
+
+	var names []string
+	for _, author := range authors {
+		if name := strings.TrimSpace(author.Name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return strings.Join(names, ", ")
+}
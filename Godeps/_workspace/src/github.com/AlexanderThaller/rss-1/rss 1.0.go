@@ -52,7 +52,7 @@ func parseRSS1(data []byte, read *db) (*Feed, error) {
 	}
 
 	if out.Refresh.IsZero() {
-		out.Refresh = time.Now().Add(10 * time.Minute)
+		out.Refresh = time.Now().Add(DefaultRefresh)
 	}
 
 	if feed.Items == nil {
@@ -80,8 +80,18 @@ func parseRSS1(data []byte, read *db) (*Feed, error) {
 
 		next := new(Item)
 		next.Title = item.Title
+		next.Summary = item.Summary
 		next.Content = item.Content
+		if next.Content == "" {
+			// Most feeds only have a description that holds the whole item.
+			next.Content = item.Summary
+		}
 		next.Link = item.Link
+		next.Author = item.Author
+		if next.Author == "" {
+			next.Author = item.Creator
+		}
+		next.Categories = append(item.Categories, item.Subjects...)
 		if item.Date != "" {
 			next.Date, err = parseTime(item.Date)
 			if err != nil {
@@ -127,13 +137,18 @@ type rss1_0Channel struct {
 }
 
 type rss1_0Item struct {
-	XMLName xml.Name `xml:"item"`
-	Title   string   `xml:"title"`
-	Content string   `xml:"description"`
-	Link    string   `xml:"link"`
-	PubDate string   `xml:"pubDate"`
-	Date    string   `xml:"date"`
-	ID      string   `xml:"guid"`
+	XMLName    xml.Name `xml:"item"`
+	Title      string   `xml:"title"`
+	Summary    string   `xml:"description"`
+	Content    string   `xml:"encoded"`
+	Link       string   `xml:"link"`
+	PubDate    string   `xml:"pubDate"`
+	Date       string   `xml:"date"`
+	ID         string   `xml:"guid"`
+	Author     string   `xml:"author"`
+	Creator    string   `xml:"creator"`
+	Categories []string `xml:"category"`
+	Subjects   []string `xml:"subject"`
 }
 
 type rss1_0Image struct {
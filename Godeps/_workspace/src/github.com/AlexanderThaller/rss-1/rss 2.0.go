@@ -23,6 +23,12 @@ func parseRSS2(data []byte, read *db) (*Feed, error) {
 
 	channel := feed.Channel
 
+	extensions := rss2_0Extensions{}
+	err = decodeExtensions(data, &extensions)
+	if err != nil {
+		return nil, err
+	}
+
 	out := new(Feed)
 	out.Title = channel.Title
 	out.Description = channel.Description
@@ -52,7 +58,7 @@ func parseRSS2(data []byte, read *db) (*Feed, error) {
 	}
 
 	if out.Refresh.IsZero() {
-		out.Refresh = time.Now().Add(10 * time.Minute)
+		out.Refresh = time.Now().Add(DefaultRefresh)
 	}
 
 	if channel.Items == nil {
@@ -63,7 +69,7 @@ func parseRSS2(data []byte, read *db) (*Feed, error) {
 	out.ItemMap = make(map[string]struct{})
 
 	// Process items.
-	for _, item := range channel.Items {
+	for i, item := range channel.Items {
 
 		if item.ID == "" {
 			if item.Link == "" {
@@ -80,8 +86,24 @@ func parseRSS2(data []byte, read *db) (*Feed, error) {
 
 		next := new(Item)
 		next.Title = item.Title
+		next.Summary = item.Summary.text("")
 		next.Content = item.Content
+		if next.Content == "" {
+			// Most feeds only have a description that holds the whole item.
+			next.Content = next.Summary
+		}
 		next.Link = item.Link
+		next.Author = item.Author.text("")
+		if next.Author == "" {
+			next.Author = item.Creator
+		}
+		next.Categories = append(item.Categories.texts(""), item.Subjects...)
+		for _, enclosure := range item.Enclosures {
+			next.addEnclosure(enclosure.URL, enclosure.Type, enclosure.Length)
+		}
+		if i < len(extensions.Items) {
+			next.addExtensions(extensions.Items[i])
+		}
 		if item.Date != "" {
 			next.Date, err = parseTime(item.Date)
 			if err != nil {
@@ -127,13 +149,19 @@ type rss2_0Channel struct {
 }
 
 type rss2_0Item struct {
-	XMLName xml.Name `xml:"item"`
-	Title   string   `xml:"title"`
-	Content string   `xml:"description"`
-	Link    string   `xml:"link"`
-	PubDate string   `xml:"pubDate"`
-	Date    string   `xml:"date"`
-	ID      string   `xml:"guid"`
+	XMLName    xml.Name       `xml:"item"`
+	Title      string         `xml:"title"`
+	Summary    xmlElements    `xml:"description"`
+	Content    string         `xml:"encoded"`
+	Link       string         `xml:"link"`
+	PubDate    string         `xml:"pubDate"`
+	Date       string         `xml:"date"`
+	ID         string         `xml:"guid"`
+	Author     xmlElements    `xml:"author"`
+	Creator    string         `xml:"creator"`
+	Categories xmlElements    `xml:"category"`
+	Subjects   []string       `xml:"subject"`
+	Enclosures []rssEnclosure `xml:"enclosure"`
 }
 
 type rss2_0Image struct {
@@ -2,18 +2,38 @@ package rss
 
 import (
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"strings"
 	"time"
 )
 
-// Parse RSS or Atom data.
+// DefaultRefresh is the time we wait before checking a feed again if the feed
+// itself does not tell us otherwise.
+const DefaultRefresh = 10 * time.Minute
+
+// ErrNotModified is returned when the server tells us that the feed did not
+// change since the last time we fetched it.
+var ErrNotModified = errors.New("feed not modified")
+
+// Parse RSS, Atom or JSON Feed data.
 func Parse(data []byte) (*Feed, error) {
+	return parse(data, "")
+}
+
+// parse detects the format of the data and parses it. A JSON content type
+// selects JSON Feed, otherwise the format is guessed from the data.
+func parse(data []byte, contentType string) (*Feed, error) {
 
-	if strings.Contains(string(data), "<rss") {
+	if isJSONFeed(data, contentType) {
+		return parseJSONFeed(data, database)
+	} else if strings.Contains(string(data), "<rss") {
 		return parseRSS2(data, database)
 	} else if strings.Contains(string(data), "xmlns=\"http://purl.org/rss/1.0/\"") {
 		return parseRSS1(data, database)
@@ -40,8 +60,28 @@ func Fetch(url string) (*Feed, error) {
 }
 
 func FetchByClient(url string, client *http.Client) (*Feed, error) {
+	return FetchConditional(url, client, "", "")
+}
+
+// FetchConditional downloads and parses the RSS feed at the given URL. The
+// etag and lastModified validators of a previous fetch are sent to the server
+// and ErrNotModified is returned if the feed did not change.
+func FetchConditional(url string, client *http.Client, etag, lastModified string) (*Feed, error) {
 	fetchFunc := func() (resp *http.Response, err error) {
-		return client.Get(url)
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
+		}
+
+		return client.Do(req)
 	}
 	return FetchByFunc(fetchFunc, url)
 }
@@ -53,12 +93,25 @@ func FetchByFunc(fetchFunc FetchFunc, url string) (*Feed, error) {
 	}
 	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, ErrNotModified
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("Error: server returned %q for %q.", resp.Status, url)
+	}
+
+	reader, err := decodeBody(resp)
 	if err != nil {
 		return nil, err
 	}
 
-	out, err := Parse(body)
+	body, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := parse(body, resp.Header.Get("Content-Type"))
 	if err != nil {
 		return nil, err
 	}
@@ -68,10 +121,35 @@ func FetchByFunc(fetchFunc FetchFunc, url string) (*Feed, error) {
 	}
 
 	out.UpdateURL = url
+	out.ETag = resp.Header.Get("ETag")
+	out.LastModified = resp.Header.Get("Last-Modified")
 
 	return out, nil
 }
 
+// decodeBody returns a reader that decompresses the body of the response
+// according to its Content-Encoding.
+func decodeBody(resp *http.Response) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(resp.Body)
+	case "deflate":
+		// Deflate should be zlib wrapped but some servers send raw deflate.
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		reader, err := zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return flate.NewReader(bytes.NewReader(body)), nil
+		}
+		return reader, nil
+	default:
+		return resp.Body, nil
+	}
+}
+
 // Feed is the top-level structure.
 type Feed struct {
 	Nickname    string // This is not set by the package, but could be helpful.
@@ -84,6 +162,9 @@ type Feed struct {
 	ItemMap     map[string]struct{} // Used in checking whether an item has been seen before.
 	Refresh     time.Time           // Earliest time this feed should next be checked.
 	Unread      uint32              // Number of unread items. Used by aggregators.
+
+	ETag         string // ETag header of the last response, sent as If-None-Match.
+	LastModified string // Last-Modified header of the last response, sent as If-Modified-Since.
 }
 
 // Update fetches any new items and updates f.
@@ -107,12 +188,18 @@ func (f *Feed) Update() (bool, error) {
 		}
 	}
 
-	update, err := Fetch(f.UpdateURL)
+	update, err := FetchConditional(f.UpdateURL, http.DefaultClient, f.ETag, f.LastModified)
+	if err == ErrNotModified {
+		f.Refresh = time.Now().Add(DefaultRefresh)
+		return false, nil
+	}
 	if err != nil {
 		return false, err
 	}
 
 	f.Refresh = update.Refresh
+	f.ETag = update.ETag
+	f.LastModified = update.LastModified
 	f.Title = update.Title
 	f.Description = update.Description
 
@@ -139,13 +226,18 @@ func (f *Feed) String() string {
 
 // Item represents a single story.
 type Item struct {
-	Title   string
-	Summary string
-	Content string
-	Link    string
-	Date    time.Time
-	ID      string
-	Read    bool
+	Title      string
+	Summary    string
+	Content    string
+	Link       string
+	Author     string
+	Categories []string
+	Enclosures []Enclosure
+	Image      string        // Cover art or thumbnail of the item.
+	Duration   time.Duration // Play time of podcasts and videos.
+	Date       time.Time
+	ID         string
+	Read       bool
 }
 
 func (i *Item) String() string {
@@ -3,7 +3,9 @@ package rss
 import (
 	"io/ioutil"
 	"log"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func Test_ParseTitle(t *testing.T) {
@@ -38,3 +40,303 @@ func Test_ParseTitle(t *testing.T) {
 		}
 	}
 }
+
+func Test_ParseAuthorCategories(t *testing.T) {
+	defer CacheParsedItemIDs(CacheParsedItemIDs(false))
+
+	m := map[string]string{
+		"rss 2.0": `<?xml version="1.0"?>
+<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd" xmlns:media="http://search.yahoo.com/mrss/">
+<channel><title>T</title>
+<item><title>I</title><guid>author-rss2</guid><dc:creator>Jane Doe</dc:creator>
+<itunes:author>John Doe</itunes:author><category>news</category><category>tech</category>
+<media:category>music</media:category></item>
+</channel></rss>`,
+		"rss 1.0": `<?xml version="1.0"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel><title>T</title></channel>
+<item><title>I</title><link>http://example.com/author-rss1</link><dc:creator>Jane Doe</dc:creator>
+<dc:subject>news</dc:subject><dc:subject>tech</dc:subject></item>
+</rdf:RDF>`,
+		"atom": `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:media="http://search.yahoo.com/mrss/"><title>T</title>
+<author><name>Jane Doe</name></author>
+<entry><title>I</title><id>author-atom</id>
+<category term="news"/><category term="tech"/><media:category label="Music">music</media:category></entry>
+</feed>`,
+	}
+
+	for k, v := range m {
+		f, e := Parse([]byte(v))
+		if e != nil {
+			t.Error(k, ": ", e)
+			continue
+		}
+
+		if len(f.Items) != 1 {
+			t.Error(k, ": expected one item but got ", len(f.Items))
+			continue
+		}
+
+		item := f.Items[0]
+		if item.Author != "Jane Doe" {
+			t.Error(k, ": got wrong author ", item.Author)
+		}
+
+		if len(item.Categories) != 2 || item.Categories[0] != "news" || item.Categories[1] != "tech" {
+			t.Error(k, ": got wrong categories ", item.Categories)
+		}
+	}
+}
+
+func Test_ParseSummaryContent(t *testing.T) {
+	defer CacheParsedItemIDs(CacheParsedItemIDs(false))
+
+	m := map[string]string{
+		"rss 2.0": `<?xml version="1.0"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/"><channel><title>T</title>
+<item><title>I</title><guid>summary-rss2</guid><description>Summary</description>
+<content:encoded><![CDATA[<p>Content</p>]]></content:encoded></item>
+<item><title>I</title><guid>description-rss2</guid><description>Summary</description></item>
+</channel></rss>`,
+		"rss 1.0": `<?xml version="1.0"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/" xmlns:content="http://purl.org/rss/1.0/modules/content/">
+<channel><title>T</title></channel>
+<item><title>I</title><link>http://example.com/summary-rss1</link><description>Summary</description>
+<content:encoded><![CDATA[<p>Content</p>]]></content:encoded></item>
+<item><title>I</title><link>http://example.com/description-rss1</link><description>Summary</description></item>
+</rdf:RDF>`,
+	}
+
+	for k, v := range m {
+		f, e := Parse([]byte(v))
+		if e != nil {
+			t.Error(k, ": ", e)
+			continue
+		}
+
+		if len(f.Items) != 2 {
+			t.Error(k, ": expected two items but got ", len(f.Items))
+			continue
+		}
+
+		// Without content:encoded the description is the content as well.
+		for i, content := range []string{"<p>Content</p>", "Summary"} {
+			item := f.Items[i]
+			if item.Summary != "Summary" || item.Content != content {
+				t.Errorf("%s: got wrong summary or content %q, %q", k, item.Summary, item.Content)
+			}
+		}
+	}
+}
+
+func Test_ParseEnclosures(t *testing.T) {
+	defer CacheParsedItemIDs(CacheParsedItemIDs(false))
+
+	m := map[string]string{
+		"rss 2.0": `<?xml version="1.0"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd" xmlns:media="http://search.yahoo.com/mrss/" xmlns:content="http://purl.org/rss/1.0/modules/content/">
+<channel><title>T</title>
+<item><title>I</title><guid>enclosure-rss2</guid><description>Summary</description>
+<content:encoded>Show notes</content:encoded>
+<enclosure url="http://example.com/episode.mp3" type="audio/mpeg" length="1024"/>
+<media:content url="http://example.com/episode.mp3" type="audio/mpeg" fileSize="1024"/>
+<media:group><media:content url="http://example.com/episode.ogg" type="audio/ogg" fileSize="512"/></media:group>
+<itunes:author>Jane Doe</itunes:author><itunes:duration>1:02:03</itunes:duration>
+<itunes:image href="http://example.com/cover.jpg"/><itunes:summary>Itunes summary</itunes:summary>
+<itunes:keywords>news, tech</itunes:keywords></item>
+</channel></rss>`,
+		"atom": `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:media="http://search.yahoo.com/mrss/"><title>T</title>
+<entry><title>I</title><id>enclosure-atom</id><author><name>Jane Doe</name></author>
+<link rel="enclosure" href="http://example.com/episode.mp3" type="audio/mpeg" length="1024"/>
+<link href="http://example.com/episode"/><content>Show notes</content>
+<media:group><media:content url="http://example.com/episode.ogg" type="audio/ogg" fileSize="512" duration="3723"/>
+<media:thumbnail url="http://example.com/cover.jpg"/><media:description>Summary</media:description>
+<media:keywords>news, tech</media:keywords></media:group></entry>
+</feed>`,
+	}
+
+	expected := []Enclosure{
+		{URL: "http://example.com/episode.mp3", Type: "audio/mpeg", Length: 1024},
+		{URL: "http://example.com/episode.ogg", Type: "audio/ogg", Length: 512},
+	}
+
+	for k, v := range m {
+		f, e := Parse([]byte(v))
+		if e != nil {
+			t.Error(k, ": ", e)
+			continue
+		}
+
+		if len(f.Items) != 1 {
+			t.Error(k, ": expected one item but got ", len(f.Items))
+			continue
+		}
+
+		item := f.Items[0]
+		if !reflect.DeepEqual(item.Enclosures, expected) {
+			t.Error(k, ": got wrong enclosures ", item.Enclosures)
+		}
+
+		if item.Duration != time.Hour+2*time.Minute+3*time.Second {
+			t.Error(k, ": got wrong duration ", item.Duration)
+		}
+
+		if item.Image != "http://example.com/cover.jpg" {
+			t.Error(k, ": got wrong image ", item.Image)
+		}
+
+		if item.Author != "Jane Doe" || item.Content != "Show notes" || item.Summary != "Summary" {
+			t.Errorf("%s: got wrong author, content or summary %q, %q, %q", k, item.Author,
+				item.Content, item.Summary)
+		}
+
+		if k == "atom" && item.Link != "http://example.com/episode" {
+			t.Error(k, ": got wrong link ", item.Link)
+		}
+
+		if len(item.Categories) != 2 || item.Categories[0] != "news" || item.Categories[1] != "tech" {
+			t.Error(k, ": got wrong categories ", item.Categories)
+		}
+	}
+}
+
+func Test_ParseMediaElements(t *testing.T) {
+	defer CacheParsedItemIDs(CacheParsedItemIDs(false))
+
+	m := map[string]string{
+		"rss 2.0": `<?xml version="1.0"?>
+<rss version="2.0" xmlns:media="http://search.yahoo.com/mrss/"><channel><title>T</title>
+<item><title>I</title><guid>media-rss2</guid><description>Summary</description>
+<media:description>Media description</media:description>
+<media:content url="http://example.com/episode.mp3" type="audio/mpeg"/></item>
+</channel></rss>`,
+		"atom": `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:media="http://search.yahoo.com/mrss/"><title>T</title>
+<entry><title>I</title><id>media-atom</id><summary>Summary</summary><content>Summary</content>
+<media:content url="http://example.com/episode.mp3" type="audio/mpeg"/>
+<media:description>Media description</media:description></entry>
+</feed>`,
+	}
+
+	for k, v := range m {
+		f, e := Parse([]byte(v))
+		if e != nil {
+			t.Error(k, ": ", e)
+			continue
+		}
+
+		if len(f.Items) != 1 {
+			t.Error(k, ": expected one item but got ", len(f.Items))
+			continue
+		}
+
+		item := f.Items[0]
+		if item.Summary != "Summary" || item.Content != "Summary" {
+			t.Errorf("%s: got wrong summary or content %q, %q", k, item.Summary, item.Content)
+		}
+
+		if len(item.Enclosures) != 1 || item.Enclosures[0].URL != "http://example.com/episode.mp3" {
+			t.Error(k, ": got wrong enclosures ", item.Enclosures)
+		}
+	}
+}
+
+func Test_ParseJSONFeed(t *testing.T) {
+	m := map[string]string{
+		"1.0": `{"version": "https://jsonfeed.org/version/1", "title": "T",
+"home_page_url": "http://example.com/", "author": {"name": "Jane Doe"},
+"items": [{"id": 1, "url": "http://example.com/episode", "title": "I",
+"content_html": "<p>Show notes</p>", "summary": "Summary", "image": "http://example.com/cover.jpg",
+"date_published": "2015-08-19T12:00:00Z", "tags": ["news", "tech"],
+"attachments": [{"url": "http://example.com/episode.mp3", "mime_type": "audio/mpeg",
+"size_in_bytes": 1024, "duration_in_seconds": 3723}]}]}`,
+		"1.1": "\xef\xbb\xbf" + `{"version": "https://jsonfeed.org/version/1.1", "title": "T",
+"home_page_url": "http://example.com/", "authors": [{"name": "Jane Doe"}],
+"items": [{"id": "1", "url": "http://example.com/episode", "title": "I",
+"content_html": "<p>Show notes</p>", "summary": "Summary", "banner_image": "http://example.com/cover.jpg",
+"date_modified": "2015-08-19T12:00:00Z", "tags": ["news", "tech"],
+"attachments": [{"url": "http://example.com/episode.mp3", "mime_type": "audio/mpeg",
+"size_in_bytes": 1024, "duration_in_seconds": 3723}]}]}`,
+	}
+
+	defer CacheParsedItemIDs(CacheParsedItemIDs(false))
+
+	for k, v := range m {
+		f, e := Parse([]byte(v))
+		if e != nil {
+			t.Error(k, ": ", e)
+			continue
+		}
+
+		if f.Title != "T" || f.Link != "http://example.com/" || len(f.Items) != 1 {
+			t.Errorf("%s: got wrong feed %q, %q with %d items", k, f.Title, f.Link, len(f.Items))
+			continue
+		}
+
+		item := f.Items[0]
+		if item.ID != "1" || item.Title != "I" || item.Link != "http://example.com/episode" {
+			t.Errorf("%s: got wrong id, title or link %q, %q, %q", k, item.ID, item.Title, item.Link)
+		}
+
+		if item.Author != "Jane Doe" || item.Content != "<p>Show notes</p>" || item.Summary != "Summary" {
+			t.Errorf("%s: got wrong author, content or summary %q, %q, %q", k, item.Author,
+				item.Content, item.Summary)
+		}
+
+		if !item.Date.Equal(time.Date(2015, 8, 19, 12, 0, 0, 0, time.UTC)) {
+			t.Error(k, ": got wrong date ", item.Date)
+		}
+
+		expected := []Enclosure{{URL: "http://example.com/episode.mp3", Type: "audio/mpeg", Length: 1024}}
+		if !reflect.DeepEqual(item.Enclosures, expected) {
+			t.Error(k, ": got wrong enclosures ", item.Enclosures)
+		}
+
+		if item.Duration != time.Hour+2*time.Minute+3*time.Second || item.Image != "http://example.com/cover.jpg" {
+			t.Error(k, ": got wrong duration or image ", item.Duration, ", ", item.Image)
+		}
+
+		if len(item.Categories) != 2 || item.Categories[0] != "news" || item.Categories[1] != "tech" {
+			t.Error(k, ": got wrong categories ", item.Categories)
+		}
+	}
+
+	_, e := Parse([]byte(`{"version": "1", "items": []}`))
+	if e == nil {
+		t.Error("expected an error for an unknown version")
+	}
+
+	// Items without id use their url, items without both are skipped.
+	f, e := Parse([]byte(`{"version": "https://jsonfeed.org/version/1.1", "title": "T",
+"items": [{"url": "http://example.com/a", "title": "A"}, {"title": "B"}]}`))
+	if e != nil {
+		t.Fatal(e)
+	}
+
+	if len(f.Items) != 1 || f.Items[0].ID != "http://example.com/a" {
+		t.Errorf("expected only the item with url but got %+v", f.Items)
+	}
+}
+
+func Test_IsJSONFeed(t *testing.T) {
+	tests := []struct {
+		data        string
+		contentType string
+		expected    bool
+	}{
+		{`{"version": "https://jsonfeed.org/version/1.1"}`, "", true},
+		{`{"version": "https://jsonfeed.org/version/1"}`, "application/json; charset=utf-8", true},
+		{`{"items": []}`, "application/feed+json", true},
+		{`{"error": "not found"}`, "application/json", false},
+		{`{"version": "2.0"}`, "", false},
+		{`<rss version="2.0"></rss>`, "application/json", false},
+	}
+
+	for _, test := range tests {
+		if isJSONFeed([]byte(test.data), test.contentType) != test.expected {
+			t.Errorf("%s (%s): expected %v", test.data, test.contentType, test.expected)
+		}
+	}
+}
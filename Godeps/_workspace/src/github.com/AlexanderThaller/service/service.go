@@ -68,6 +68,8 @@ func WatchSignals() {
 		signal := <-sigc
 
 		switch signal {
+		case syscall.SIGHUP:
+			reloadServices()
 		case syscall.SIGINT:
 			stopServices()
 			return
@@ -84,6 +86,12 @@ func stopServices() {
 	}
 }
 
+func reloadServices() {
+	for _, d := range services {
+		d.Reload()
+	}
+}
+
 // Count returns the number of services.
 func Count() uint {
 	return uint(len(services))
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"html"
+	"sort"
+	"strconv"
+	"time"
+
+	rss "github.com/AlexanderThaller/rss-1"
+	"github.com/juju/errgo"
+)
+
+const (
+	// CatchupAll will send every item.
+	CatchupAll = "all"
+	// CatchupNone will mark every item as seen without sending it.
+	CatchupNone = "none"
+	// CatchupNewest will only send the newest Count items.
+	CatchupNewest = "newest"
+	// CatchupSince will only send items that are newer than Since.
+	CatchupSince = "since"
+	// CatchupDigest will send a single notification for all matching items.
+	CatchupDigest = "digest"
+
+	// DigestFilter is used as the filter of digest notifications.
+	DigestFilter = "digest"
+
+	DefaultCatchupCount  = 5
+	DefaultCatchupOutage = 24 * time.Hour
+)
+
+// Catchup decides what happens with the items of a feed that is fetched for
+// the first time or that was not checked for longer than Outage.
+type Catchup struct {
+	Mode   string
+	Count  int    `json:",omitempty"`
+	Since  string `json:",omitempty"`
+	Outage string `json:",omitempty"`
+}
+
+// Validate checks the mode and durations of the policy.
+func (catchup Catchup) Validate() error {
+	switch catchup.Mode {
+	case "", CatchupAll, CatchupNone, CatchupDigest:
+	case CatchupNewest:
+		if catchup.Count <= 0 {
+			return errgo.New("catchup mode newest needs a count above zero")
+		}
+	case CatchupSince:
+		if catchup.Since == "" {
+			return errgo.New("catchup mode since needs a duration")
+		}
+	default:
+		return errgo.New("unknown catchup mode " + catchup.Mode)
+	}
+
+	for _, duration := range []string{catchup.Since, catchup.Outage} {
+		if duration == "" {
+			continue
+		}
+
+		_, err := time.ParseDuration(duration)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Missed returns true if the feed was not checked for longer than Outage.
+func (catchup Catchup) Missed(refresh time.Time) bool {
+	outage, err := parseDurationDefault(catchup.Outage, 0)
+	if err != nil || outage == 0 {
+		return false
+	}
+
+	return time.Since(refresh) > outage
+}
+
+// Select returns the items that should be sent one by one. For the digest
+// mode all items are returned and have to be combined by the caller.
+func (catchup Catchup) Select(items []*rss.Item) []*rss.Item {
+	switch catchup.Mode {
+	case CatchupNone:
+		return nil
+
+	case CatchupNewest:
+		sorted := make([]*rss.Item, len(items))
+		copy(sorted, items)
+		sort.Stable(itemsByDate(sorted))
+
+		if len(sorted) > catchup.Count {
+			sorted = sorted[:catchup.Count]
+		}
+
+		return sorted
+
+	case CatchupSince:
+		since, err := time.ParseDuration(catchup.Since)
+		if err != nil {
+			return nil
+		}
+
+		var out []*rss.Item
+		for _, item := range items {
+			if !item.Date.IsZero() && time.Since(item.Date) <= since {
+				out = append(out, item)
+			}
+		}
+
+		return out
+
+	default:
+		return items
+	}
+}
+
+// itemsByDate sorts items from the newest to the oldest. Items without a date
+// keep their position relative to each other.
+type itemsByDate []*rss.Item
+
+func (items itemsByDate) Len() int      { return len(items) }
+func (items itemsByDate) Swap(i, j int) { items[i], items[j] = items[j], items[i] }
+func (items itemsByDate) Less(i, j int) bool {
+	return items[i].Date.After(items[j].Date)
+}
+
+// digestItem combines the given items into a single item.
+func digestItem(feed *rss.Feed, items []*rss.Item) *rss.Item {
+	now := time.Now()
+
+	content := bytes.NewBufferString("<ul>\n")
+	for _, item := range items {
+		content.WriteString(`<li><a href="` + html.EscapeString(item.Link) + `">` +
+			html.EscapeString(item.Title) + "</a></li>\n")
+	}
+	content.WriteString("</ul>")
+
+	return &rss.Item{
+		Title:   strconv.Itoa(len(items)) + " new items",
+		Content: content.String(),
+		Link:    feed.Link,
+		Date:    now,
+		ID:      feed.UpdateURL + "#digest-" + strconv.FormatInt(now.UnixNano(), 10),
+	}
+}
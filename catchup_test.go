@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	rss "github.com/AlexanderThaller/rss-1"
+)
+
+func TestCatchupSelect(t *testing.T) {
+	now := time.Now()
+	items := []*rss.Item{
+		{ID: "old", Date: now.Add(-48 * time.Hour)},
+		{ID: "new", Date: now.Add(-1 * time.Hour)},
+		{ID: "newer", Date: now.Add(-1 * time.Minute)},
+		{ID: "undated"},
+	}
+
+	tests := map[string]struct {
+		catchup  Catchup
+		expected []string
+	}{
+		"all":    {Catchup{Mode: CatchupAll}, []string{"old", "new", "newer", "undated"}},
+		"none":   {Catchup{Mode: CatchupNone}, nil},
+		"newest": {Catchup{Mode: CatchupNewest, Count: 2}, []string{"newer", "new"}},
+		"since":  {Catchup{Mode: CatchupSince, Since: "2h"}, []string{"new", "newer"}},
+	}
+
+	for test, values := range tests {
+		err := values.catchup.Validate()
+		if err != nil {
+			t.Error(test, ": ", err)
+			continue
+		}
+
+		var got []string
+		for _, item := range values.catchup.Select(items) {
+			got = append(got, item.ID)
+		}
+
+		if len(got) != len(values.expected) {
+			t.Error(test, ": expected ", values.expected, " but got ", got)
+			continue
+		}
+
+		for i := range got {
+			if got[i] != values.expected[i] {
+				t.Error(test, ": expected ", values.expected, " but got ", got)
+				break
+			}
+		}
+	}
+}
+
+func TestCatchupMissed(t *testing.T) {
+	catchup := Catchup{Mode: CatchupDigest, Outage: "1h"}
+
+	if catchup.Missed(time.Now().Add(-10 * time.Minute)) {
+		t.Error("a short pause should not count as outage")
+	}
+
+	if !catchup.Missed(time.Now().Add(-2 * time.Hour)) {
+		t.Error("a long pause should count as outage")
+	}
+
+	if (Catchup{Mode: CatchupDigest}).Missed(time.Time{}) {
+		t.Error("without an outage duration there should be no outage")
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/AlexanderThaller/config"
+	"github.com/AlexanderThaller/logger"
+	rss "github.com/AlexanderThaller/rss-1"
+	"github.com/juju/errgo"
+)
+
+// commands can be given as the first argument after the flags. Without a
+// command the feeds are watched.
+var commands = map[string]func(args []string) error{
+	"convert":     commandConvert,
+	"export-opml": commandExportOPML,
+	"import-opml": commandImportOPML,
+	"sieve":       commandSieve,
+	"test":        commandTest,
+}
+
+// commandConvert reads the config file given as the first argument and
+// writes it to the second one. The formats are detected by the extensions
+// of the files.
+func commandConvert(args []string) error {
+	l := logger.New(name, "commandConvert")
+
+	if len(args) != 2 {
+		return errgo.New("usage: convert <from> <to>")
+	}
+
+	conf := new(Config)
+	err := config.Load(args[0], conf)
+	if err != nil {
+		return errgo.Notef(err, "can not read %s", args[0])
+	}
+
+	l.Info("Converting ", args[0], " from ", config.Format(args[0]), " to ",
+		config.Format(args[1]))
+	err = config.Save(args[1], conf)
+	if err != nil {
+		return errgo.Notef(err, "can not write %s", args[1])
+	}
+
+	return nil
+}
+
+// commandImportOPML adds the feeds of the opml file given as the first
+// argument to the config file. Feeds that are already configured are
+// skipped.
+func commandImportOPML(args []string) error {
+	l := logger.New(name, "commandImportOPML")
+
+	if len(args) != 1 {
+		return errgo.New("usage: import-opml <file>")
+	}
+
+	data, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	feeds, err := importOPML(data)
+	if err != nil {
+		return errgo.Notef(err, "can not read %s", args[0])
+	}
+
+	// Without a config file the feeds are imported into an empty config as
+	// the default config contains a sample feed.
+	conf := new(Config)
+	_, err = os.Stat(*flagConfigPath)
+	if !os.IsNotExist(err) {
+		conf, err = reconfigure(*flagConfigPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	var imported int
+	for _, feed := range feeds {
+		if findFeed(conf, feed.Url) != -1 {
+			l.Notice("Skipping feed that is already configured: ", feed.Url)
+			continue
+		}
+
+		conf.Feeds = append(conf.Feeds, feed)
+		imported++
+	}
+
+	l.Notice("Imported ", imported, " feeds into ", *flagConfigPath)
+	return config.Update(*flagConfigPath, conf)
+}
+
+// commandExportOPML writes the feeds of the config file as opml to the file
+// given as the first argument or to stdout.
+func commandExportOPML(args []string) error {
+	if len(args) > 1 {
+		return errgo.New("usage: export-opml [file]")
+	}
+
+	conf, err := reconfigure(*flagConfigPath)
+	if err != nil {
+		return err
+	}
+
+	data, err := exportOPML(conf.Feeds)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	return ioutil.WriteFile(args[0], data, 0644)
+}
+
+// commandSieve writes a sieve script for the mails sent with the config file
+// to the file given as the first argument or to stdout.
+func commandSieve(args []string) error {
+	if len(args) > 1 {
+		return errgo.New("usage: sieve [file]")
+	}
+
+	conf, err := reconfigure(*flagConfigPath)
+	if err != nil {
+		return err
+	}
+
+	data := generateSieve(conf)
+	if len(args) == 0 {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	return ioutil.WriteFile(args[0], data, 0644)
+}
+
+// commandTest shows which items of the feed or file given as the first
+// argument match the filter given as the second one and which messages would
+// be sent for them. The settings of the config file are used if it exists.
+// Nothing is saved and no notifications are sent.
+func commandTest(args []string) error {
+	if len(args) != 2 {
+		return errgo.New("usage: test <url or file> <filter>")
+	}
+
+	conf := new(Config)
+	_, err := os.Stat(*flagConfigPath)
+	if os.IsNotExist(err) {
+		conf.Default()
+	} else {
+		conf, err = reconfigure(*flagConfigPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	return testFilter(os.Stdout, conf, args[0], args[1])
+}
+
+// testFilter runs the filter against the items of the source the same way a
+// watched feed would and writes the matches with their messages to w. The
+// global filters are skipped so only items that match the filter are shown.
+func testFilter(w io.Writer, conf *Config, source, expression string) error {
+	l := logger.New(name, "testFilter", source)
+
+	settings := Feed{Url: source}
+	if index := findFeed(conf, source); index != -1 {
+		settings = conf.Feeds[index]
+	}
+	settings.Filters = []Filter{{Expression: expression}}
+	settings.Notifiers = nil
+	settings.SkipGlobalFilters = true
+
+	// The notifiers are never called so every declared one is left empty.
+	notifiers := make(map[string]Notifier)
+	for notifierName := range declaredNotifiers(conf) {
+		notifiers[notifierName] = nil
+	}
+
+	feed := new(Feed)
+	err := feed.Configure(settings, conf, notifiers)
+	if err != nil {
+		return err
+	}
+
+	// Every item should be shown even if the parser saw it before.
+	defer rss.CacheParsedItemIDs(rss.CacheParsedItemIDs(false))
+
+	var data *rss.Feed
+	if _, err := os.Stat(source); err == nil {
+		l.Debug("Reading feed from file")
+		raw, err := ioutil.ReadFile(source)
+		if err != nil {
+			return err
+		}
+
+		data, err = rss.Parse(raw)
+		if err != nil {
+			return errgo.Notef(err, "can not parse %s", source)
+		}
+	} else {
+		l.Debug("Fetching feed")
+		data, err = rss.Fetch(source)
+		if err != nil {
+			return errgo.Notef(err, "can not fetch %s", source)
+		}
+	}
+	feed.setData(data)
+
+	var matches int
+	for _, item := range data.Items {
+		filtered := feed.Filter(item)
+		if filtered == nil {
+			continue
+		}
+		matches++
+
+		message, err := feed.GenerateMessage(filtered, conf.MailDestination)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(w, "Match: %s (%s)\n\n", strings.TrimSpace(item.Title),
+			strings.Join(filtered.Filters, ", "))
+		fmt.Fprintf(w, "%s\n\n", message)
+	}
+
+	fmt.Fprintf(w, "%d of %d items match\n", matches, len(data.Items))
+	return nil
+}
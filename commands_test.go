@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AlexanderThaller/config"
+)
+
+func TestCommandConvert(t *testing.T) {
+	folder, err := ioutil.TempDir("", "rsswatch-convert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	expected := new(Config)
+	expected.Default()
+	expected.Feeds[0].Filters = append(expected.Feeds[0].Filters,
+		Filter{Expression: "/a/ and not /b/", Field: FilterFieldSummary, Priority: 1})
+	expected.Feeds[0].Catchup = &Catchup{Mode: CatchupAll}
+
+	paths := []string{"config.json", "config.toml", "config.yaml", "converted.json"}
+	for i := range paths {
+		paths[i] = filepath.Join(folder, paths[i])
+	}
+
+	err = config.Save(paths[0], expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i < len(paths); i++ {
+		err = commandConvert([]string{paths[i-1], paths[i]})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		converted := new(Config)
+		err = config.Load(paths[i], converted)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(converted, expected) {
+			data, _ := ioutil.ReadFile(paths[i])
+			t.Errorf("%s does not match the original config:\n%s", paths[i], data)
+		}
+	}
+
+	err = commandConvert([]string{paths[0]})
+	if err == nil {
+		t.Error("expected an error for a missing argument")
+	}
+}
+
+func TestCommandTest(t *testing.T) {
+	server := testFeedServer()
+	defer server.Close()
+
+	folder, err := ioutil.TempDir("", "rsswatch-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	path := filepath.Join(folder, "feed.xml")
+	err = ioutil.WriteFile(path, []byte(testFeedData), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &Config{
+		DataFolder: filepath.Join(folder, "data"),
+		Notifiers: map[string]NotifierConfig{
+			"file": {Type: NotifierTypeFile, Path: filepath.Join(folder, "items")},
+		},
+		GlobalFilters: GlobalFilters{
+			Include: []Filter{{Expression: "item"}},
+			Exclude: []Filter{{Expression: "Excluded"}},
+		},
+	}
+
+	tests := []struct {
+		Source     string
+		Expression string
+		Expected   []string
+	}{
+		{server.URL, "First", []string{"Match: First item (First)", "Subject: First item", "1 of 1 items match"}},
+		{path, "/First/ and content:/content/i", []string{"Filters: /First/ and content:/content/i", "1 of 1 items match"}},
+		{path, "Second", []string{"0 of 1 items match"}},
+	}
+
+	for _, test := range tests {
+		var output bytes.Buffer
+		err := testFilter(&output, conf, test.Source, test.Expression)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, expected := range test.Expected {
+			if !strings.Contains(output.String(), expected) {
+				t.Errorf("%s %s: expected %q in output:\n%s", test.Source, test.Expression,
+					expected, output.String())
+			}
+		}
+	}
+
+	for _, unexpected := range []string{conf.DataFolder, filepath.Join(folder, "items")} {
+		if _, err := os.Stat(unexpected); !os.IsNotExist(err) {
+			t.Error("testing the filter created ", unexpected)
+		}
+	}
+
+	err = testFilter(ioutil.Discard, conf, path, "/(broken")
+	if err == nil {
+		t.Error("expected an error for an invalid filter")
+	}
+
+	defer func(configPath string) { *flagConfigPath = configPath }(*flagConfigPath)
+	*flagConfigPath = filepath.Join(folder, "missing.cnf")
+
+	err = commandTest([]string{path, "First"})
+	if err != nil {
+		t.Error("expected the test command to work without a config file: ", err)
+	}
+}
+
+func TestCommandImportOPML(t *testing.T) {
+	folder, err := ioutil.TempDir("", "rsswatch-import")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	path := filepath.Join(folder, "feeds.opml")
+	err = ioutil.WriteFile(path, []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<opml version="1.0">
+<body>
+  <outline text="Example" type="rss" xmlUrl="http://localhost/feed"/>
+</body>
+</opml>`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(configPath string) { *flagConfigPath = configPath }(*flagConfigPath)
+	*flagConfigPath = filepath.Join(folder, "config.cnf")
+
+	// Importing twice creates the config with only the imported feed and
+	// skips it the second time.
+	for i := 0; i < 2; i++ {
+		err = commandImportOPML([]string{path})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conf, err := reconfigure(*flagConfigPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(conf.Feeds) != 1 || conf.Feeds[0].Url != "http://localhost/feed" {
+		t.Errorf("expected only the imported feed but got %+v", conf.Feeds)
+	}
+}
@@ -6,21 +6,44 @@ import (
 )
 
 type Config struct {
-	DataFolder      string
-	Feeds           []Feed
-	LogLevel        map[logger.Logger]string
-	MailDestination string
-	MailDisable     bool
-	MailSender      string
-	MailServer      string
-	SaveFeeds       bool
-	XmppDestination string
-	XmppDisable     bool
-	XmppDomain      string
-	XmppPassword    string
-	XmppPort        uint16
-	XmppSkipTLS     bool
-	XmppUsername    string
+	Catchup              Catchup
+	DataFolder           string
+	FeedAlertThreshold   int
+	FeedBackoffMax       string
+	FeedBackoffMin       string
+	Feeds                []Feed
+	GlobalFilters        GlobalFilters
+	HistorySize          int
+	HttpListen           string
+	HttpToken            string
+	LogLevel             map[logger.Logger]string
+	MailAuth             string
+	MailCAFile           string
+	MailDestination      string
+	MailDisable          bool
+	MailDownloadMaxSize  int64
+	MailEnclosureMaxSize int64
+	MailEnclosures       string
+	MailPassword         string
+	MailSender           string
+	MailServer           string
+	MailTLS              string
+	MailTLSPin           string
+	MailUsername         string
+	Notifiers            map[string]NotifierConfig `json:",omitempty"`
+	PrimaryFilter        string
+	QueueBackoffMax      string
+	QueueBackoffMin      string
+	QueueMaxAttempts     int
+	SaveFeeds            bool
+	Templates            Templates
+	XmppDestination      string
+	XmppDisable          bool
+	XmppDomain           string
+	XmppPassword         string
+	XmppPort             uint16
+	XmppSkipTLS          bool
+	XmppUsername         string
 }
 
 func (co *Config) Default() {
@@ -29,14 +52,28 @@ func (co *Config) Default() {
 
 	e := Feed{
 		Url:     "https://en.wikipedia.org/w/index.php?title=Special:RecentChanges&feed=atom",
-		Filters: []string{".*Talk:.*"},
+		Filters: []Filter{{Expression: ".*Talk:.*"}},
 		Folder:  "misc",
 	}
 
 	co.Feeds = append(co.Feeds, e)
 
+	co.Catchup = Catchup{
+		Mode:   CatchupNewest,
+		Count:  DefaultCatchupCount,
+		Outage: DefaultCatchupOutage.String(),
+	}
+
+	co.PrimaryFilter = PrimaryFilterFirst
 	co.DataFolder = "feeds"
+	co.FeedAlertThreshold = DefaultFeedAlertThreshold
+	co.FeedBackoffMax = DefaultFeedBackoffMax.String()
+	co.FeedBackoffMin = DefaultFeedBackoffMin.String()
+	co.HistorySize = DefaultHistorySize
 	co.SaveFeeds = true
+	co.QueueBackoffMax = DefaultQueueBackoffMax.String()
+	co.QueueBackoffMin = DefaultQueueBackoffMin.String()
+	co.QueueMaxAttempts = DefaultQueueMaxAttempts
 	co.XmppDisable = true
 	co.XmppDestination = "admin@ejabberd"
 	co.XmppDomain = "ejabberd"
@@ -45,6 +82,8 @@ func (co *Config) Default() {
 	co.XmppSkipTLS = true
 	co.XmppUsername = "test"
 	co.MailDisable = false
+	co.MailDownloadMaxSize = DefaultMailDownloadMaxSize
+	co.MailEnclosureMaxSize = DefaultMailEnclosureMaxSize
 	co.MailDestination = "alexander@thaller.ws"
 	co.MailServer = "mail.thaller.ws:25"
 	co.MailSender = "rsswatch@thaller.ws"
@@ -62,6 +101,30 @@ func configure(path string) (conf *Config, err error) {
 	return
 }
 
+// reconfigure will read the config file again. Unlike configure it will not
+// create a default config if the file does not exist.
+func reconfigure(path string) (*Config, error) {
+	conf := new(Config)
+	err := config.Load(path, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	return conf, nil
+}
+
+// findFeed returns the index of the feed with the given url or -1 if the
+// config does not contain the feed.
+func findFeed(conf *Config, url string) int {
+	for index, feed := range conf.Feeds {
+		if feed.Url == url {
+			return index
+		}
+	}
+
+	return -1
+}
+
 // setup will prepare the environemt based on the values of the
 // given configuration.
 func setup(conf *Config) (err error) {
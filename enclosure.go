@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AlexanderThaller/logger"
+	rss "github.com/AlexanderThaller/rss-1"
+	"github.com/juju/errgo"
+)
+
+const (
+	// MailEnclosuresLink only links the enclosures in the mail.
+	MailEnclosuresLink = ""
+	// MailEnclosuresAttach attaches the enclosures that are not larger than
+	// MailEnclosureMaxSize to the mail.
+	MailEnclosuresAttach = "attach"
+	// MailEnclosuresDownload downloads the enclosures that are not larger
+	// than MailDownloadMaxSize into the enclosures folder of the
+	// data folder before the mail is sent.
+	MailEnclosuresDownload = "download"
+
+	// EnclosureFolder is the folder in the data folder the enclosures are
+	// downloaded to. Every feed gets its own folder in it.
+	EnclosureFolder = "enclosures"
+
+	DefaultMailEnclosureMaxSize = 10 << 20
+	DefaultMailDownloadMaxSize  = 1 << 30
+
+	// DefaultEnclosureTimeout is the time all enclosures of an item may
+	// take together so a slow server can only hold up the feed for a
+	// bounded time.
+	DefaultEnclosureTimeout = 2 * time.Minute
+)
+
+var enclosureClient = &http.Client{}
+
+// enclosureTimeout is the time all enclosures of an item may take together.
+var enclosureTimeout = DefaultEnclosureTimeout
+
+func validateMailEnclosures(conf *Config) error {
+	switch conf.MailEnclosures {
+	case MailEnclosuresLink, MailEnclosuresAttach, MailEnclosuresDownload:
+		return nil
+	default:
+		return errgo.New("unknown mail enclosures mode " + conf.MailEnclosures)
+	}
+}
+
+// prepareEnclosures fetches or downloads the enclosures of the item
+// depending on the enclosures mode of the feed. It only does so once per
+// item so that every mail notifier can use the result.
+func (feed *Feed) prepareEnclosures(item *Item) {
+	if item.enclosuresPrepared {
+		return
+	}
+	item.enclosuresPrepared = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), enclosureTimeout)
+	defer cancel()
+
+	switch feed.Config().MailEnclosures {
+	case MailEnclosuresAttach:
+		feed.fetchEnclosures(ctx, item)
+	case MailEnclosuresDownload:
+		feed.downloadEnclosures(ctx, item)
+	}
+}
+
+// fetchEnclosures fetches the enclosures of the item to be attached to the
+// messages. Enclosures that are too large or can not be fetched are skipped
+// as they are still linked in the message.
+func (feed *Feed) fetchEnclosures(ctx context.Context, item *Item) {
+	l := logger.New(name, "Feed", "fetchEnclosures", feed.Url, item.data.ID)
+
+	limit := feed.Config().MailEnclosureMaxSize
+	if limit <= 0 {
+		limit = DefaultMailEnclosureMaxSize
+	}
+
+	for _, enclosure := range item.data.Enclosures {
+		if enclosure.Length > limit {
+			l.Info("Not attaching ", enclosure.URL, " as it is larger than ", formatSize(limit))
+			continue
+		}
+
+		data, err := fetchEnclosure(ctx, enclosure.URL, limit)
+		if err != nil {
+			l.Warning("Can not attach ", enclosure.URL, ": ", err)
+			continue
+		}
+
+		item.attachments = append(item.attachments,
+			mailAttachment{enclosureFilename(enclosure), enclosure.Type, data})
+	}
+}
+
+// downloadEnclosures downloads the enclosures of the item into the folder
+// of the feed in the enclosures folder. Enclosures that were already
+// downloaded are skipped. Enclosures that are too large or can not be
+// downloaded are still linked in the message.
+func (feed *Feed) downloadEnclosures(ctx context.Context, item *Item) {
+	l := logger.New(name, "Feed", "downloadEnclosures", feed.Url, item.data.ID)
+
+	limit := feed.Config().MailDownloadMaxSize
+	if limit <= 0 {
+		limit = DefaultMailDownloadMaxSize
+	}
+
+	folder := filepath.Join(feed.Config().DataFolder, EnclosureFolder, feed.Filename(""))
+	for _, enclosure := range item.data.Enclosures {
+		if enclosure.Length > limit {
+			l.Info("Only linking ", enclosure.URL, " as it is larger than ", formatSize(limit))
+			continue
+		}
+
+		filename := filepath.Join(folder, enclosureFilename(enclosure))
+		if _, err := os.Stat(filename); err == nil {
+			l.Debug("Enclosure ", enclosure.URL, " was already downloaded")
+			continue
+		}
+
+		l.Debug("Downloading ", enclosure.URL, " to ", filename)
+		err := downloadEnclosure(ctx, enclosure.URL, filename, limit)
+		if err != nil {
+			l.Warning("Can not download ", enclosure.URL, ", only linking it: ", err)
+		}
+	}
+}
+
+func fetchEnclosure(ctx context.Context, location string, limit int64) ([]byte, error) {
+	resp, err := getEnclosure(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, errgo.New("server returned " + resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > limit {
+		return nil, errgo.New("enclosure is larger than " + formatSize(limit))
+	}
+
+	return data, nil
+}
+
+// downloadEnclosure writes the enclosure to a temporary file first so that
+// aborted downloads are not taken for complete ones. Downloads that get
+// larger than the limit are aborted.
+func downloadEnclosure(ctx context.Context, location, filename string, limit int64) error {
+	err := os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return err
+	}
+
+	resp, err := getEnclosure(ctx, location)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errgo.New("server returned " + resp.Status)
+	}
+
+	if resp.ContentLength > limit {
+		return errgo.New("enclosure is larger than " + formatSize(limit))
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(filename), ".download")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	written, err := io.Copy(file, io.LimitReader(resp.Body, limit+1))
+	if err == nil && written > limit {
+		err = errgo.New("enclosure is larger than " + formatSize(limit))
+	}
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), filename)
+}
+
+// getEnclosure requests the enclosure. The request is aborted when the
+// context is done, also while the body is still being read.
+func getEnclosure(ctx context.Context, location string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", location, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return enclosureClient.Do(request)
+}
+
+// enclosureFilename returns the name of the file in the url of the
+// enclosure prefixed with a hash of the url so that enclosures with the same
+// name do not overwrite each other.
+func enclosureFilename(enclosure rss.Enclosure) string {
+	hash := sha256.Sum256([]byte(enclosure.URL))
+	prefix := hex.EncodeToString(hash[:4])
+
+	base := "enclosure"
+	parsed, err := url.Parse(enclosure.URL)
+	if err == nil {
+		if name := path.Base(parsed.Path); name != "/" && name != "." {
+			base = strings.Map(func(r rune) rune {
+				if r == '/' || r == '\\' || r < ' ' {
+					return '_'
+				}
+				return r
+			}, name)
+		}
+	}
+
+	return prefix + "-" + base
+}
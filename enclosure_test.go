@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	rss "github.com/AlexanderThaller/rss-1"
+)
+
+func TestEnclosures(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch r.URL.Path {
+		case "/small.mp3":
+			w.Write([]byte("small"))
+		case "/large.mp3":
+			w.Write(bytes.Repeat([]byte("large"), 10))
+		case "/stream.mp3":
+			// Flushing leaves out the content length.
+			for i := 0; i < 10; i++ {
+				w.Write([]byte("stream"))
+				w.(http.Flusher).Flush()
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	folder, err := ioutil.TempDir("", "rsswatch-enclosures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	conf := &Config{
+		DataFolder:           folder,
+		MailDownloadMaxSize:  20,
+		MailEnclosures:       MailEnclosuresAttach,
+		MailEnclosureMaxSize: 20,
+	}
+
+	feed := new(Feed)
+	err = feed.Configure(Feed{Url: server.URL, Filters: []Filter{{Expression: "Episode"}}}, conf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	small := rss.Enclosure{URL: server.URL + "/small.mp3", Type: "audio/mpeg"}
+	item := feed.Filter(&rss.Item{
+		ID:    "episode",
+		Title: "Episode",
+		Enclosures: []rss.Enclosure{
+			small,
+			{URL: server.URL + "/large.mp3", Type: "audio/mpeg"},
+			{URL: server.URL + "/stream.mp3", Type: "audio/mpeg"},
+			{URL: server.URL + "/declared.mp3", Type: "audio/mpeg", Length: 100},
+			{URL: server.URL + "/missing.mp3", Type: "audio/mpeg"},
+		},
+	})
+
+	// Every mail notifier generates its own message but the enclosures are
+	// only fetched once for the item.
+	for i := 0; i < 2; i++ {
+		data, err := feed.GenerateMessage(item, "admin@example.org")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		attachments := readAttachments(t, data.Bytes())
+		if len(attachments) != 1 || attachments[enclosureFilename(small)] != "small" {
+			t.Errorf("expected only the small enclosure to be attached but got %q", attachments)
+		}
+	}
+
+	if atomic.LoadInt32(&requests) != 4 {
+		t.Error("expected the declared large enclosure to not be fetched but got ", requests, " requests")
+	}
+
+	conf.MailEnclosures = MailEnclosuresDownload
+	atomic.StoreInt32(&requests, 0)
+	for i := 0; i < 2; i++ {
+		item.enclosuresPrepared = false
+		feed.prepareEnclosures(item)
+	}
+
+	// Enclosures that are too large are only linked and the declared large
+	// enclosure is not requested at all.
+	if atomic.LoadInt32(&requests) != 7 {
+		t.Error("expected enclosures to be downloaded once but got ", requests, " requests")
+	}
+
+	downloaded, err := ioutil.ReadFile(filepath.Join(folder, EnclosureFolder, feed.Filename(""),
+		enclosureFilename(small)))
+	if err != nil || string(downloaded) != "small" {
+		t.Errorf("expected the small enclosure to be downloaded but got %q: %v", downloaded, err)
+	}
+
+	files, _ := ioutil.ReadDir(filepath.Join(folder, EnclosureFolder, feed.Filename("")))
+	if len(files) != 1 {
+		t.Error("expected one downloaded enclosure but got ", len(files))
+	}
+}
+
+func TestEnclosuresTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { enclosureTimeout = timeout }(enclosureTimeout)
+	enclosureTimeout = 100 * time.Millisecond
+
+	stalled := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("stalled"))
+		w.(http.Flusher).Flush()
+		select {
+		case <-stalled:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(stalled)
+
+	conf := &Config{MailEnclosures: MailEnclosuresAttach}
+	feed := new(Feed)
+	err := feed.Configure(Feed{Url: server.URL, Filters: []Filter{{Expression: "Episode"}}}, conf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item := feed.Filter(&rss.Item{
+		ID:    "episode",
+		Title: "Episode",
+		Enclosures: []rss.Enclosure{
+			{URL: server.URL + "/first.mp3", Type: "audio/mpeg"},
+			{URL: server.URL + "/second.mp3", Type: "audio/mpeg"},
+		},
+	})
+
+	start := time.Now()
+	feed.prepareEnclosures(item)
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Error("expected the stalled enclosures to be given up on but they took ", elapsed)
+	}
+
+	if len(item.attachments) != 0 {
+		t.Error("expected no attachments but got ", len(item.attachments))
+	}
+}
+
+// readAttachments returns the decoded attachments of a mail by filename.
+func readAttachments(t *testing.T, data []byte) map[string]string {
+	message, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "multipart/mixed" {
+		t.Fatal("expected a multipart/mixed message but got ", mediaType)
+	}
+
+	attachments := make(map[string]string)
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := reader.NextRawPart()
+		if err != nil {
+			break
+		}
+
+		if part.FileName() == "" {
+			continue
+		}
+
+		content, err := ioutil.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		attachments[part.FileName()] = string(content)
+	}
+
+	return attachments
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	rss "github.com/AlexanderThaller/rss-1"
+	"github.com/juju/errgo"
+)
+
+// A filter expression combines regex terms with and, or, not and
+// parentheses. A term is a regex between slashes with an optional field
+// prefix and an optional i flag for case insensitive matching:
+//
+//	/Release/ and not (title:/beta/i or category:/draft/)
+//
+// Slashes inside of a term have to be escaped with a backslash. Terms
+// without a field prefix match the field of the filter. Strings that do not
+// start with a complete term followed by a space, a parenthesis or the end
+// (optionally after "not" and opening parentheses) are plain regexes.
+
+type expressionNode interface {
+	match(item *rss.Item) bool
+}
+
+type expressionTerm struct {
+	field  string
+	regexp *regexp.Regexp
+}
+
+func (node expressionTerm) match(item *rss.Item) bool {
+	values, _ := itemFields(node.field, item)
+	for _, value := range values {
+		if node.regexp.MatchString(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type expressionAnd struct {
+	left, right expressionNode
+}
+
+func (node expressionAnd) match(item *rss.Item) bool {
+	return node.left.match(item) && node.right.match(item)
+}
+
+type expressionOr struct {
+	left, right expressionNode
+}
+
+func (node expressionOr) match(item *rss.Item) bool {
+	return node.left.match(item) || node.right.match(item)
+}
+
+type expressionNot struct {
+	node expressionNode
+}
+
+func (node expressionNot) match(item *rss.Item) bool {
+	return !node.node.match(item)
+}
+
+type expressionParser struct {
+	input string
+	pos   int
+	field string
+}
+
+// isExpression returns true if the given string is a filter expression and
+// not a plain regex. The first term has to be complete and followed by the
+// end, a space or a parenthesis as plain regexes like /r/golang only look
+// like they start with a term.
+func isExpression(input string) bool {
+	parser := &expressionParser{input: input}
+
+	for {
+		parser.skipSpace()
+
+		if parser.consume("(") {
+			continue
+		}
+
+		if parser.keyword("not") {
+			continue
+		}
+
+		if !parser.startsTerm() {
+			return false
+		}
+
+		_, _, err := parser.readTerm()
+		if err != nil {
+			return false
+		}
+
+		rest := parser.input[parser.pos:]
+		return rest == "" || strings.HasPrefix(rest, ")") || unicode.IsSpace(rune(rest[0]))
+	}
+}
+
+// parseExpression parses the given filter expression. Terms without a field
+// prefix will match the given field.
+func parseExpression(input, field string) (expressionNode, error) {
+	parser := &expressionParser{input: input, field: field}
+
+	node, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	parser.skipSpace()
+	if parser.pos != len(parser.input) {
+		return nil, parser.errorf("unexpected input")
+	}
+
+	return node, nil
+}
+
+func (parser *expressionParser) parseOr() (expressionNode, error) {
+	left, err := parser.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		parser.skipSpace()
+		if !parser.keyword("or") {
+			return left, nil
+		}
+
+		right, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		left = expressionOr{left, right}
+	}
+}
+
+func (parser *expressionParser) parseAnd() (expressionNode, error) {
+	left, err := parser.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		parser.skipSpace()
+		if !parser.keyword("and") {
+			return left, nil
+		}
+
+		right, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		left = expressionAnd{left, right}
+	}
+}
+
+func (parser *expressionParser) parseUnary() (expressionNode, error) {
+	parser.skipSpace()
+
+	if parser.keyword("not") {
+		node, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return expressionNot{node}, nil
+	}
+
+	if parser.consume("(") {
+		node, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		parser.skipSpace()
+		if !parser.consume(")") {
+			return nil, parser.errorf("expected )")
+		}
+
+		return node, nil
+	}
+
+	return parser.parseTerm()
+}
+
+func (parser *expressionParser) parseTerm() (expressionNode, error) {
+	if !parser.startsTerm() {
+		return nil, parser.errorf("expected a /regex/ term")
+	}
+
+	field, pattern, err := parser.readTerm()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = itemFields(field, new(rss.Item))
+	if err != nil {
+		return nil, parser.errorf(err.Error())
+	}
+
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errgo.Notef(err, "filter %q", parser.input)
+	}
+
+	return expressionTerm{field: field, regexp: compiled}, nil
+}
+
+// readTerm reads the term at the current position and returns its field and
+// its pattern. The i flag is added to the pattern as (?i).
+func (parser *expressionParser) readTerm() (string, string, error) {
+	field := parser.field
+	if !strings.HasPrefix(parser.input[parser.pos:], "/") {
+		end := strings.Index(parser.input[parser.pos:], ":")
+		field = parser.input[parser.pos : parser.pos+end]
+		parser.pos += end + 1
+	}
+
+	// Skip the opening slash and read until the closing one. The pattern is
+	// collected as bytes so multibyte characters stay intact.
+	parser.pos++
+	var pattern []byte
+	for {
+		if parser.pos >= len(parser.input) {
+			return "", "", parser.errorf("unterminated regex")
+		}
+
+		char := parser.input[parser.pos]
+		if char == '\\' && parser.pos+1 < len(parser.input) && parser.input[parser.pos+1] == '/' {
+			pattern = append(pattern, '/')
+			parser.pos += 2
+			continue
+		}
+
+		parser.pos++
+		if char == '/' {
+			break
+		}
+
+		pattern = append(pattern, char)
+	}
+
+	if parser.consume("i") {
+		pattern = append([]byte("(?i)"), pattern...)
+	}
+
+	return field, string(pattern), nil
+}
+
+// startsTerm returns true if a term starts at the current position.
+func (parser *expressionParser) startsTerm() bool {
+	rest := parser.input[parser.pos:]
+	if strings.HasPrefix(rest, "/") {
+		return true
+	}
+
+	for i, char := range rest {
+		if char == ':' {
+			return i > 0 && strings.HasPrefix(rest[i+1:], "/")
+		}
+
+		if !unicode.IsLetter(char) {
+			return false
+		}
+	}
+
+	return false
+}
+
+// keyword consumes the given word if it is followed by a space, a
+// parenthesis or a term.
+func (parser *expressionParser) keyword(word string) bool {
+	rest := parser.input[parser.pos:]
+	if len(rest) < len(word) || !strings.EqualFold(rest[:len(word)], word) {
+		return false
+	}
+
+	next := rest[len(word):]
+	if next != "" && !strings.HasPrefix(next, "(") && !strings.HasPrefix(next, "/") &&
+		!unicode.IsSpace(rune(next[0])) {
+		return false
+	}
+
+	parser.pos += len(word)
+	return true
+}
+
+func (parser *expressionParser) consume(token string) bool {
+	if !strings.HasPrefix(parser.input[parser.pos:], token) {
+		return false
+	}
+
+	parser.pos += len(token)
+	return true
+}
+
+func (parser *expressionParser) skipSpace() {
+	for parser.pos < len(parser.input) && unicode.IsSpace(rune(parser.input[parser.pos])) {
+		parser.pos++
+	}
+}
+
+func (parser *expressionParser) errorf(message string) error {
+	return errgo.Newf("%s at position %d in filter %q", message, parser.pos, parser.input)
+}
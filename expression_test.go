@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+
+	rss "github.com/AlexanderThaller/rss-1"
+)
+
+func TestFilterExpression(t *testing.T) {
+	item := &rss.Item{
+		Title:      "Talk:Go release",
+		Summary:    "The new release is out",
+		Link:       "http://localhost/go/release",
+		Categories: []string{"news", "draft", "Käse"},
+		Enclosures: []rss.Enclosure{{URL: "http://localhost/go.mp3", Type: "audio/mpeg"}},
+	}
+
+	tests := []struct {
+		filter Filter
+		match  bool
+	}{
+		{Filter{Expression: ".*Talk:.*"}, true},
+		{Filter{Expression: "(Go|Rust) release"}, true},
+		{Filter{Expression: "not /Talk:/"}, false},
+		{Filter{Expression: "/release/ and not /Talk:/"}, false},
+		{Filter{Expression: "/release/ and not category:/beta/"}, true},
+		{Filter{Expression: "/beta/ or summary:/new release/"}, true},
+		{Filter{Expression: "/go/i and (link:/\\/go\\// or /Rust/)"}, true},
+		{Filter{Expression: "not (/Rust/ or category:/draft/)"}, false},
+		{Filter{Expression: "/out/", Field: FilterFieldSummary}, true},
+		{Filter{Expression: "/out/ and title:/Go/", Field: FilterFieldSummary}, true},
+		{Filter{Expression: "enclosure:/^audio\\// and not enclosure:/\\.ogg$/"}, true},
+		{Filter{Expression: "/video/", Field: FilterFieldEnclosure}, false},
+		{Filter{Expression: "category:/^Käse$/"}, true},
+		{Filter{Expression: "category:/KÄSE/i"}, true},
+		{Filter{Expression: "/release/ AND NOT /Käse/"}, true},
+		// Plain regexes that do not start with a complete term.
+		{Filter{Expression: "/go/release", Field: FilterFieldLink}, true},
+		{Filter{Expression: "/r/golang", Field: FilterFieldLink}, false},
+		{Filter{Expression: "/go/i.mp3", Field: FilterFieldEnclosure}, false},
+		{Filter{Expression: "not /release"}, false},
+	}
+
+	for _, test := range tests {
+		err := test.filter.Compile()
+		if err != nil {
+			t.Error(test.filter.Expression, ": ", err)
+			continue
+		}
+
+		if test.filter.Match(item) != test.match {
+			t.Error(test.filter.Expression, ": expected match to be ", test.match)
+		}
+	}
+}
+
+func TestFilterExpressionErrors(t *testing.T) {
+	expressions := []string{
+		"/release/ and",
+		"(/release/ or /beta/",
+		"/release/ /beta/",
+		"/release/ or /beta",
+		"/release/ nand /beta/",
+		"unknown:/release/",
+		"(/(/)",
+		"/(/",
+	}
+
+	for _, expression := range expressions {
+		filter := Filter{Expression: expression}
+		if filter.Compile() == nil {
+			t.Error(expression, ": expected an error")
+		}
+	}
+}
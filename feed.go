@@ -5,8 +5,8 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/AlexanderThaller/logger"
@@ -15,84 +15,433 @@ import (
 	"github.com/vmihailenco/msgpack"
 )
 
+const (
+	// DefaultRecentMatches is the number of matched items every feed shows in
+	// the http api.
+	DefaultRecentMatches = 20
+)
+
 type Feed struct {
-	Url     string
-	Filters []string
-	Folder  string
-	filters map[string]*regexp.Regexp
-	data    *rss.Feed
-	config  *Config
-	mails   chan<- *bytes.Buffer
+	Url               string
+	Filters           []Filter
+	Folder            string
+	Notifiers         []string   `json:",omitempty"`
+	Catchup           *Catchup   `json:",omitempty"`
+	SkipGlobalFilters bool       `json:",omitempty"`
+	Paused            bool       `json:",omitempty"`
+	Templates         *Templates `json:",omitempty"`
+	filters           map[string]*Filter
+	order             []string
+	excludes          []*Filter
+	routes            map[string][]Notifier
+	templates         *messageTemplates
+	digest            []Notifier
+	data              *rss.Feed
+	config            *Config
+	missed            bool
+	status            FeedStatus
+	history           []historyEntry
+	lock              *sync.RWMutex
+	stop              chan struct{}
 }
 
-func (feed Feed) Launch(conf *Config, mails chan<- *bytes.Buffer) error {
+func (feed *Feed) Launch(conf *Config, notifiers map[string]Notifier) error {
 	l := logger.New(name, "Feed", "Launch", feed.Url)
 	l.Info("Starting")
 
-	feed.config = conf
-	feed.mails = mails
+	err := feed.Configure(*feed, conf, notifiers)
+	if err != nil {
+		return err
+	}
+
+	feed.stop = make(chan struct{})
+	go feed.Watch()
+
+	return nil
+}
+
+// Configure will take over the settings of the given feed, compile its
+// filters together with the global ones and route them to the notifiers. It
+// can be called while the feed is watched, the feed data will not be
+// touched.
+func (feed *Feed) Configure(settings Feed, conf *Config, notifiers map[string]Notifier) error {
+	l := logger.New(name, "Feed", "Configure", feed.Url)
+
+	include := settings.Filters
+	var exclude []Filter
+	if !settings.SkipGlobalFilters {
+		l.Debug("Adding global filters")
+		include = append(append([]Filter{}, include...), conf.GlobalFilters.Include...)
+		exclude = conf.GlobalFilters.Exclude
+	}
 
 	l.Debug("Setting up filters")
-	feed.filters = make(map[string]*regexp.Regexp)
+	filters := make(map[string]*Filter)
+	routes := make(map[string][]Notifier)
+	var order []string
+	for _, filter := range include {
+		filter := filter
+		if _, exists := filters[filter.Name()]; exists {
+			l.Debug("Filter ", filter.Name(), " is already set up")
+			continue
+		}
+
+		err := filter.Compile()
+		if err != nil {
+			return err
+		}
+
+		names := filter.Notifiers
+		if len(names) == 0 {
+			names = settings.Notifiers
+		}
+
+		route, err := routeNotifiers(notifiers, names)
+		if err != nil {
+			return err
+		}
+
+		filters[filter.Name()] = &filter
+		routes[filter.Name()] = route
+		order = append(order, filter.Name())
+	}
+
+	var excludes []*Filter
+	for _, filter := range exclude {
+		filter := filter
+		err := filter.Compile()
+		if err != nil {
+			return err
+		}
+
+		excludes = append(excludes, &filter)
+	}
+
+	digest, err := routeNotifiers(notifiers, settings.Notifiers)
+	if err != nil {
+		return err
+	}
+
+	templates, err := compileTemplates(conf.Templates, settings.Templates)
+	if err != nil {
+		return err
+	}
+
+	if feed.lock == nil {
+		feed.lock = new(sync.RWMutex)
+	}
+
+	feed.lock.Lock()
+	defer feed.lock.Unlock()
+
+	feed.Filters = settings.Filters
+	feed.Folder = settings.Folder
+	feed.Notifiers = settings.Notifiers
+	feed.Catchup = settings.Catchup
+	feed.SkipGlobalFilters = settings.SkipGlobalFilters
+	feed.Paused = settings.Paused
+	feed.Templates = settings.Templates
+	feed.filters = filters
+	feed.order = order
+	feed.excludes = excludes
+	feed.routes = routes
+	feed.digest = digest
+	feed.templates = templates
+	feed.config = conf
+
+	return nil
+}
+
+// Validate will compile the filters of the feed and check that all notifiers
+// it routes to are declared.
+func (feed Feed) Validate(declared map[string]NotifierConfig) error {
+	names := append([]string{}, feed.Notifiers...)
 	for _, filter := range feed.Filters {
-		compiled, err := regexp.Compile(filter)
+		err := filter.Compile()
+		if err != nil {
+			return err
+		}
+
+		err = filter.validateSieve()
 		if err != nil {
 			return err
 		}
 
-		feed.filters[filter] = compiled
+		names = append(names, filter.Notifiers...)
 	}
 
-	go feed.Watch()
+	for _, notifierName := range names {
+		if _, exists := declared[notifierName]; !exists {
+			return errgo.New("unknown notifier " + notifierName)
+		}
+	}
+
+	if feed.Templates != nil {
+		err := feed.Templates.Validate()
+		if err != nil {
+			return err
+		}
+	}
+
+	if feed.Catchup != nil {
+		return feed.Catchup.Validate()
+	}
 
 	return nil
 }
 
-func (feed Feed) Watch() {
-	l := logger.New(name, "Feed", "Watch", feed.Url)
+// Stop will stop watching the feed.
+func (feed *Feed) Stop() {
+	close(feed.stop)
+}
 
-	l.Debug("Will try to get feed")
-	err := feed.Get(feed.config)
+// CatchupPolicy returns the catchup policy of the feed or the global one if
+// the feed has none.
+func (feed *Feed) CatchupPolicy() Catchup {
+	feed.lock.RLock()
+	defer feed.lock.RUnlock()
+
+	if feed.Catchup != nil {
+		return *feed.Catchup
+	}
+
+	return feed.config.Catchup
+}
+
+// Config returns the config the feed is currently running with.
+func (feed *Feed) Config() *Config {
+	feed.lock.RLock()
+	defer feed.lock.RUnlock()
+
+	return feed.config
+}
+
+// Title returns the title of the feed or the url if the feed was never
+// fetched.
+func (feed *Feed) Title() string {
+	feed.lock.RLock()
+	defer feed.lock.RUnlock()
+
+	if feed.data == nil {
+		return feed.Url
+	}
+
+	return strings.TrimSpace(feed.data.Title)
+}
+
+// setData replaces the data of the feed. Only the goroutine that fetches
+// the feed changes the data, other goroutines have to hold the lock to read
+// it.
+func (feed *Feed) setData(data *rss.Feed) {
+	feed.lock.Lock()
+	defer feed.lock.Unlock()
+
+	feed.data = data
+}
+
+// Status returns the health record of the feed.
+func (feed *Feed) Status() FeedStatus {
+	feed.lock.RLock()
+	defer feed.lock.RUnlock()
+
+	return feed.status
+}
+
+// Recent returns the last items that matched a filter, the newest first.
+func (feed *Feed) Recent() []itemEntry {
+	history := feed.History()
+	if len(history) > DefaultRecentMatches {
+		history = history[:DefaultRecentMatches]
+	}
+
+	recent := make([]itemEntry, len(history))
+	for i, entry := range history {
+		recent[i] = entry.itemEntry
+	}
+
+	return recent
+}
+
+// remember adds the item to the history of the feed and saves the history.
+// Only the newest matches up to the HistorySize are kept.
+func (feed *Feed) remember(item *Item) {
+	l := logger.New(name, "Feed", "remember", feed.Url, item.data.ID)
+
+	entry := newHistoryEntry(item)
+
+	feed.lock.Lock()
+	size := feed.config.HistorySize
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+
+	feed.history = append(feed.history, entry)
+	if len(feed.history) > size {
+		feed.history = feed.history[len(feed.history)-size:]
+	}
+
+	history := append([]historyEntry{}, feed.history...)
+	datafolder := feed.config.DataFolder
+	feed.lock.Unlock()
+
+	err := feed.SaveHistory(datafolder, history)
 	if err != nil {
-		l.Error("can not get feed data")
-		return
+		l.Warning("Can not save history: ", errgo.Details(err))
+	}
+}
+
+// Watch will fetch the feed whenever it has to be refreshed and send the
+// new items. Failed fetches are retried with a growing delay.
+func (feed *Feed) Watch() {
+	l := logger.New(name, "Feed", "Watch", feed.Url)
+
+	err := feed.RestoreHealth(feed.Config().DataFolder)
+	if err != nil && !os.IsNotExist(err) {
+		l.Warning("Can not restore health record: ", errgo.Details(err))
+	}
+
+	err = feed.RestoreHistory(feed.Config().DataFolder)
+	if err != nil && !os.IsNotExist(err) {
+		l.Warning("Can not restore history: ", errgo.Details(err))
+	}
+
+	for {
+		l.Debug("Will try to get feed")
+		fetched, err := feed.Get(feed.Config())
+
+		// Restoring the saved feed is no check of the feed so only fetches
+		// are recorded in the health record.
+		status := feed.Status()
+		if fetched {
+			status = feed.record(err)
+		}
+		if err == nil {
+			break
+		}
+
+		delay := feed.retryDelay(status.Failures)
+		l.Warning("Can not get feed data, retrying in ", delay, ": ", errgo.Details(err))
+		if !feed.sleep(delay) {
+			return
+		}
 	}
 	l.Debug("Got feed")
 
+	var failures int
 	for {
 		refresh := feed.data.Refresh
+		if failures != 0 {
+			refresh = time.Now().Add(feed.retryDelay(failures))
+		}
 
 		d := refresh.Sub(time.Now())
 		l.Debug("Sleep for ", d, " (Until ", refresh, ")")
-		time.Sleep(d)
-
-		items := make(map[string]struct{})
-		for item := range feed.data.ItemMap {
-			items[item] = struct{}{}
+		if !feed.sleep(d) {
+			return
 		}
 
-		l.Trace("Items length: ", len(items))
-		l.Debug("Try to update feed")
-		updated, err := feed.data.Update()
+		status, err := feed.update()
+		failures = status.Failures
 		if err != nil {
 			l.Warning("Can not update feed: ", errgo.Details(err))
 		}
+	}
+}
 
-		if !updated {
-			l.Debug("Not updated")
-			continue
+// Poll will fetch the feed once if it is due and send the new items. It is
+// used instead of Watch when running once.
+func (feed *Feed) Poll() error {
+	l := logger.New(name, "Feed", "Poll", feed.Url)
+	conf := feed.Config()
+
+	err := feed.RestoreHealth(conf.DataFolder)
+	if err != nil && !os.IsNotExist(err) {
+		l.Warning("Can not restore health record: ", errgo.Details(err))
+	}
+
+	err = feed.RestoreHistory(conf.DataFolder)
+	if err != nil && !os.IsNotExist(err) {
+		l.Warning("Can not restore history: ", errgo.Details(err))
+	}
+
+	if conf.SaveFeeds {
+		err := feed.Restore(conf.DataFolder)
+		if err != nil && !os.IsNotExist(err) {
+			return err
 		}
 
-		l.Debug("Checking for new items")
-		feed.Check(items)
+		if err == nil {
+			if feed.data.Refresh.After(time.Now()) {
+				l.Debug("Feed is not due until ", feed.data.Refresh)
+				return nil
+			}
 
-		l.Debug("Updated feed will now try to save")
-		err = feed.Save(feed.config.DataFolder)
-		if err != nil {
-			l.Error("Problem while saving: ", errgo.Details(err))
-			return
+			feed.missed = feed.CatchupPolicy().Missed(feed.data.Refresh)
+			_, err = feed.update()
+			return err
 		}
 	}
+
+	l.Debug("Will try to get feed")
+	fetched, err := feed.Get(conf)
+	if fetched {
+		feed.record(err)
+	}
+	return err
+}
+
+// update will fetch the feed again, send the new items and save the feed.
+func (feed *Feed) update() (FeedStatus, error) {
+	l := logger.New(name, "Feed", "update", feed.Url)
+
+	items := make(map[string]struct{})
+	for item := range feed.data.ItemMap {
+		items[item] = struct{}{}
+	}
+
+	l.Trace("Items length: ", len(items))
+	l.Debug("Try to update feed")
+
+	// The copy is updated so the title can be read while the feed is
+	// fetched.
+	data := *feed.data
+	updated, err := data.Update()
+	feed.setData(&data)
+
+	status := feed.record(err)
+	if err != nil {
+		return status, err
+	}
+
+	if !updated {
+		l.Debug("Not updated")
+		return status, nil
+	}
+
+	l.Debug("Checking for new items")
+	feed.Check(items)
+
+	l.Debug("Updated feed will now try to save")
+	err = feed.Save(feed.Config().DataFolder)
+	if err != nil {
+		return status, errgo.Notef(err, "can not save feed")
+	}
+
+	return status, nil
+}
+
+// sleep waits for the given duration. It returns false if the feed was
+// stopped in the meantime.
+func (feed *Feed) sleep(d time.Duration) bool {
+	l := logger.New(name, "Feed", "sleep", feed.Url)
+
+	select {
+	case <-feed.stop:
+		l.Info("Stopped")
+		return false
+	case <-time.After(d):
+		return true
+	}
 }
 
 func (feed *Feed) Send(item *rss.Item) {
@@ -100,76 +449,223 @@ func (feed *Feed) Send(item *rss.Item) {
 	l.Trace("Sending item: ", item)
 
 	filtered := feed.Filter(item)
-	for _, item := range filtered {
-		message, err := feed.GenerateMessage(item)
+	if filtered == nil {
+		return
+	}
+
+	// Every notifier gets the item only once even if several of the matching
+	// filters route to it.
+	var routes []Notifier
+	seen := make(map[Notifier]struct{})
+	feed.lock.RLock()
+	for _, filterName := range filtered.Filters {
+		for _, notifier := range feed.routes[filterName] {
+			if _, exists := seen[notifier]; exists {
+				continue
+			}
+
+			seen[notifier] = struct{}{}
+			routes = append(routes, notifier)
+		}
+	}
+	feed.lock.RUnlock()
+
+	feed.remember(filtered)
+
+	l.Debug("Notifying for filters ", filtered.Filters)
+	feed.Notify(filtered, routes)
+	l.Debug("Notified")
+}
+
+func (feed *Feed) Notify(item *Item, notifiers []Notifier) {
+	l := logger.New(name, "Feed", "Notify", feed.Url, item.data.ID)
+
+	for _, notifier := range notifiers {
+		err := notifier.Notify(item)
 		if err != nil {
-			l.Warning("Can not generate message: ", err)
+			l.Warning("Can not notify: ", err)
 			continue
 		}
-		l.Trace("Message: ", message.String())
+	}
+}
+
+// CatchUp will send the given items according to the catchup policy of the
+// feed. It is used for new feeds and feeds that come back after an outage.
+func (feed *Feed) CatchUp(items []*rss.Item) {
+	l := logger.New(name, "Feed", "CatchUp", feed.Url)
 
-		l.Debug("Sending email for filter ", item.Filter)
-		feed.mails <- message
-		l.Debug("Sent mail")
+	policy := feed.CatchupPolicy()
+	l.Debug("Catching up on ", len(items), " items with mode ", policy.Mode)
+
+	var matched []*rss.Item
+	for _, item := range items {
+		if feed.Filter(item) != nil {
+			matched = append(matched, item)
+		}
 	}
+
+	if policy.Mode != CatchupDigest {
+		for _, item := range policy.Select(matched) {
+			feed.Send(item)
+		}
+
+		return
+	}
+
+	if len(matched) == 0 {
+		l.Debug("No matching items for the digest")
+		return
+	}
+
+	feed.lock.RLock()
+	digest := &Item{
+		Filter: DigestFilter,
+		Folder: feed.Folder,
+		feed:   feed,
+		data:   digestItem(feed.data, matched),
+	}
+	notifiers := feed.digest
+	feed.lock.RUnlock()
+
+	l.Debug("Sending digest of ", len(matched), " items")
+	feed.Notify(digest, notifiers)
 }
 
-func (feed *Feed) GenerateMessage(item *Item) (*bytes.Buffer, error) {
-	l := logger.New(name, "Feed", "Generate", "Message", item.data.ID)
-	l.SetLevel(logger.Debug)
+// GenerateMessage renders the mail for the item with the templates of the
+// feed. The message id is derived from the item so that the same item always
+// gets the same id and all items of the feed reference the id of the feed to
+// be shown as one thread.
+func (feed *Feed) GenerateMessage(item *Item, destination string) (*bytes.Buffer, error) {
+	data, templates := feed.messageData(item)
 
-	buffer := bytes.NewBufferString("")
+	subject, err := execute(templates.subject, data)
+	if err != nil {
+		return nil, err
+	}
+	subject = strings.Join(strings.Fields(subject), " ")
 
-	ftitle := strings.TrimSpace(feed.data.Title)
-	ftitle = strings.Replace(ftitle, ".", "_", -1)
-	ititle := strings.TrimSpace(item.data.Title)
-	sender := feed.config.MailSender
+	message := new(mailMessage)
+	message.text, err = execute(templates.text, data)
+	if err != nil {
+		return nil, err
+	}
 
-	buffer.WriteString("From: " + sender + "\n")
-	buffer.WriteString("Subject: " + ititle + "\n")
-	buffer.WriteString("Content-Type: text/html; charset=utf-8\n")
-	buffer.WriteString("Feed: " + ftitle + "\n")
-	buffer.WriteString("Folder: " + feed.Folder + "\n")
+	message.html, err = execute(templates.html, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if feed.Config().MailEnclosures == MailEnclosuresAttach {
+		feed.prepareEnclosures(item)
+		message.attachments = append(message.attachments, item.attachments...)
+	}
+
+	ftitle := strings.Replace(data.Feed.Title, ".", "_", -1)
+	sender := feed.Config().MailSender
+
+	message.Add("Date", time.Now().Format(time.RFC1123Z))
+	message.Add("From", sender)
+	message.Add("To", destination)
+	message.Add("Subject", subject)
+	message.Add("Message-ID", messageID(sender, feed.Url, item.data.ID))
+	message.Add("References", messageID(sender, feed.Url))
+	message.Add("Feed", ftitle)
+	message.Add("Folder", item.Folder)
 
 	ifilter := strings.Replace(item.Filter, ".", `_`, -1)
 	if ifilter != "_*" {
-		buffer.WriteString("Filter: " + ifilter + "\n")
+		message.Add("Filter", ifilter)
 	}
 
-	buffer.WriteString("\n\n")
-
-	buffer.WriteString(ftitle + " - " + ititle + "<br>\n")
-	buffer.WriteString(item.data.Content)
+	for _, filterName := range item.Filters {
+		message.Add("Filters", strings.Replace(filterName, ".", `_`, -1))
+	}
 
-	buffer.WriteString("<br>\n")
-	buffer.WriteString(`<a href="` + item.data.Link + `">Link</a>`)
+	buffer := bytes.NewBufferString("")
+	err = message.WriteTo(buffer)
+	if err != nil {
+		return nil, err
+	}
 
 	return buffer, nil
 }
 
-func (feed *Feed) Filter(item *rss.Item) []*Item {
+// GenerateXmppMessage renders the plain text body of the item.
+func (feed *Feed) GenerateXmppMessage(item *Item) (string, error) {
+	data, templates := feed.messageData(item)
+	return execute(templates.text, data)
+}
+
+// messageData returns the data the templates are executed with together
+// with the templates of the feed.
+func (feed *Feed) messageData(item *Item) (messageData, *messageTemplates) {
+	data := messageData{
+		Feed: messageFeed{
+			Title: feed.Title(),
+			Url:   feed.Url,
+		},
+		Item:    item.data,
+		Filter:  item.Filter,
+		Filters: item.Filters,
+		Folder:  item.Folder,
+		Date:    item.data.Date,
+	}
+	if feed.data != nil {
+		data.Feed.Link = feed.data.Link
+	}
+	if data.Date.IsZero() {
+		data.Date = time.Now()
+	}
+
+	feed.lock.RLock()
+	defer feed.lock.RUnlock()
+
+	return data, feed.templates
+}
+
+// Filter returns the item with all filters it matches or nil if it does
+// not match any filter.
+func (feed *Feed) Filter(item *rss.Item) *Item {
 	l := logger.New(name, "Feed", "Filter", feed.Url, item.ID)
 	l.Trace("Item: ", item)
 	l.Debug("Checking filter for ", item.Title)
 
-	var out []*Item
-	for filter, compiled := range feed.filters {
-		l.Debug("Checking filter: ", filter)
+	feed.lock.RLock()
+	defer feed.lock.RUnlock()
+
+	for _, filter := range feed.excludes {
+		if filter.Match(item) {
+			l.Debug("Item is excluded by global filter ", filter.Name())
+			return nil
+		}
+	}
+
+	var matched []*Filter
+	var names []string
+	for _, filterName := range feed.order {
+		l.Debug("Checking filter: ", filterName)
 
-		matches := compiled.MatchString(item.Title)
-		if !matches {
+		filter := feed.filters[filterName]
+		if !filter.Match(item) {
 			l.Debug("Item does not match")
 			continue
 		}
-		l.Debug("Item matches filter adding to output")
+		l.Debug("Item matches filter")
 
-		newitem := Item{
-			Filter: filter,
-			data:   item,
-		}
+		matched = append(matched, filter)
+		names = append(names, filterName)
+	}
+
+	if len(matched) == 0 {
+		return nil
+	}
 
-		l.Trace("Newitem: ", newitem)
-		out = append(out, &newitem)
+	out := &Item{
+		Filter:  primaryFilter(feed.config.PrimaryFilter, matched).Name(),
+		Filters: names,
+		Folder:  feed.Folder,
+		feed:    feed,
+		data:    item,
 	}
 
 	l.Trace(out)
@@ -179,21 +675,34 @@ func (feed *Feed) Filter(item *rss.Item) []*Item {
 func (feed *Feed) Check(items map[string]struct{}) {
 	l := logger.New(name, "Feed", "Check", feed.Url)
 
-	newitems := feed.data.Items
+	var newitems []*rss.Item
 	l.Trace("Items: ", items)
-	for _, item := range newitems {
+	for _, item := range feed.data.Items {
 		l.Trace("Item id: ", item.ID)
 		_, exists := items[item.ID]
 
 		l.Trace("Exists: ", exists)
 		if !exists {
 			l.Trace("New item: ", item)
-			feed.Send(item)
+			newitems = append(newitems, item)
 		}
 	}
+
+	if feed.missed {
+		l.Info("Feed was not checked for a long time, catching up")
+		feed.missed = false
+		feed.CatchUp(newitems)
+		return
+	}
+
+	for _, item := range newitems {
+		feed.Send(item)
+	}
 }
 
-func (feed *Feed) Get(conf *Config) error {
+// Get restores the saved feed or fetches it if it was not saved. It returns
+// true if the feed was fetched.
+func (feed *Feed) Get(conf *Config) (bool, error) {
 	l := logger.New(name, "Feed", "Get", feed.Url)
 
 	if conf.SaveFeeds {
@@ -201,14 +710,15 @@ func (feed *Feed) Get(conf *Config) error {
 
 		err := feed.Restore(conf.DataFolder)
 		if err == nil {
+			feed.missed = feed.CatchupPolicy().Missed(feed.data.Refresh)
 			l.Debug("Restored feed. Will return feed")
-			return nil
+			return false, nil
 		}
 
 		l.Debug("Can not restore feed")
 		if !os.IsNotExist(err) {
 			l.Debug("Error is not a not exists error we will return this")
-			return err
+			return false, err
 		}
 
 		l.Trace("Error while restoring: ", err)
@@ -217,23 +727,21 @@ func (feed *Feed) Get(conf *Config) error {
 	l.Debug("Will try to fetch feed")
 	data, err := rss.Fetch(feed.Url)
 	if err != nil {
-		return err
+		return true, err
 	}
 	l.Debug("Fetched feed")
-	feed.data = data
+	feed.setData(data)
 
-	for _, item := range data.Items {
-		feed.Send(item)
-	}
+	feed.CatchUp(data.Items)
 
 	if conf.SaveFeeds {
 		err = feed.Save(conf.DataFolder)
 		if err != nil {
-			return err
+			return true, err
 		}
 	}
 
-	return err
+	return true, err
 }
 
 func (feed *Feed) Restore(datafolder string) error {
@@ -265,7 +773,7 @@ func (feed *Feed) Restore(datafolder string) error {
 	l.Debug("Finished unmarshaling")
 	l.Debug("Finished restoring")
 	l.Trace("Data: ", data)
-	feed.data = &data
+	feed.setData(&data)
 
 	return nil
 }
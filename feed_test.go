@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+
+	rss "github.com/AlexanderThaller/rss-1"
+)
+
+func TestFeedGlobalFilters(t *testing.T) {
+	conf := &Config{
+		GlobalFilters: GlobalFilters{
+			Include: []Filter{{Expression: "Release"}},
+			Exclude: []Filter{{Expression: "category:/spam/"}},
+		},
+	}
+
+	tests := []struct {
+		feed    Feed
+		item    rss.Item
+		filters int
+	}{
+		{Feed{Filters: []Filter{{Expression: "Go"}}}, rss.Item{Title: "Go Release"}, 2},
+		{Feed{Filters: []Filter{{Expression: "Go"}}}, rss.Item{Title: "Go"}, 1},
+		{Feed{Filters: []Filter{{Expression: "Release"}}}, rss.Item{Title: "Go Release"}, 1},
+		{Feed{Filters: []Filter{{Expression: "Go"}}}, rss.Item{Title: "Go Release", Categories: []string{"spam"}}, 0},
+		{Feed{Filters: []Filter{{Expression: "Go"}}, SkipGlobalFilters: true}, rss.Item{Title: "Go Release", Categories: []string{"spam"}}, 1},
+	}
+
+	for i, test := range tests {
+		feed := test.feed
+		err := feed.Configure(test.feed, conf, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var filters []string
+		filtered := feed.Filter(&test.item)
+		if filtered != nil {
+			filters = filtered.Filters
+		}
+
+		if len(filters) != test.filters {
+			t.Error(i, ": expected ", test.filters, " matching filters but got ", len(filters))
+		}
+	}
+}
+
+func TestFeedPrimaryFilter(t *testing.T) {
+	settings := Feed{
+		Filters: []Filter{
+			{Expression: "Go"},
+			{Expression: "Go Release", Priority: 1},
+			{Expression: "Release", Priority: 2},
+		},
+	}
+	item := &rss.Item{Title: "Go Release"}
+
+	tests := map[string]string{
+		PrimaryFilterFirst:    "Go",
+		PrimaryFilterLongest:  "Go Release",
+		PrimaryFilterPriority: "Release",
+	}
+
+	for rule, expected := range tests {
+		feed := settings
+		err := feed.Configure(settings, &Config{PrimaryFilter: rule}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filtered := feed.Filter(item)
+		if filtered == nil {
+			t.Error(rule, ": item did not match")
+			continue
+		}
+
+		if filtered.Filter != expected {
+			t.Error(rule, ": expected primary filter ", expected, " but got ", filtered.Filter)
+		}
+
+		if len(filtered.Filters) != 3 {
+			t.Error(rule, ": expected 3 matching filters but got ", filtered.Filters)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+
+	rss "github.com/AlexanderThaller/rss-1"
+	"github.com/juju/errgo"
+)
+
+const (
+	FilterFieldTitle     = "title"
+	FilterFieldSummary   = "summary"
+	FilterFieldContent   = "content"
+	FilterFieldLink      = "link"
+	FilterFieldAuthor    = "author"
+	FilterFieldCategory  = "category"
+	FilterFieldEnclosure = "enclosure"
+	FilterFieldAny       = "any"
+
+	// PrimaryFilterFirst picks the matching filter that comes first in the
+	// config. The filters of the feed come before the global filters.
+	PrimaryFilterFirst = "first"
+	// PrimaryFilterLongest picks the matching filter with the longest
+	// expression as it is usually the most specific one.
+	PrimaryFilterLongest = "longest"
+	// PrimaryFilterPriority picks the matching filter with the highest
+	// priority. Filters with the same priority are picked like with first.
+	PrimaryFilterPriority = "priority"
+)
+
+// Filter describes which items of a feed we want to be notified about. In
+// the config file a filter can either be written as a plain regex string or
+// as an object with additional settings. Field names the part of the item
+// the expression is matched against and defaults to the title. The
+// expression is either a plain regex or a filter expression that combines
+// several regexes with and, or and not.
+type Filter struct {
+	Expression string
+	Field      string     `json:",omitempty"`
+	Notifiers  []string   `json:",omitempty"`
+	Priority   int        `json:",omitempty"`
+	Sieve      *SieveRule `json:",omitempty"`
+	compiled   expressionNode
+}
+
+// GlobalFilters are combined with the filters of every feed that does not
+// skip them. Items that match one of the exclude filters are dropped no
+// matter which other filters they match.
+type GlobalFilters struct {
+	Include []Filter `json:",omitempty"`
+	Exclude []Filter `json:",omitempty"`
+}
+
+// Validate will compile the global filters and check that all notifiers they
+// route to are declared.
+func (global GlobalFilters) Validate(declared map[string]NotifierConfig) error {
+	for _, filter := range append(global.Include, global.Exclude...) {
+		err := filter.Compile()
+		if err != nil {
+			return err
+		}
+
+		err = filter.validateSieve()
+		if err != nil {
+			return err
+		}
+
+		for _, notifierName := range filter.Notifiers {
+			if _, exists := declared[notifierName]; !exists {
+				return errgo.New("unknown notifier " + notifierName)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Compile will check and prepare the expression of the filter.
+func (filter *Filter) Compile() error {
+	_, err := itemFields(filter.Field, new(rss.Item))
+	if err != nil {
+		return err
+	}
+
+	if isExpression(filter.Expression) {
+		compiled, err := parseExpression(filter.Expression, filter.Field)
+		if err != nil {
+			return err
+		}
+
+		filter.compiled = compiled
+		return nil
+	}
+
+	compiled, err := regexp.Compile(filter.Expression)
+	if err != nil {
+		return err
+	}
+
+	filter.compiled = expressionTerm{field: filter.Field, regexp: compiled}
+	return nil
+}
+
+func (filter *Filter) validateSieve() error {
+	if filter.Sieve == nil {
+		return nil
+	}
+
+	err := filter.Sieve.Validate()
+	if err != nil {
+		return errgo.Notef(err, "sieve rule of filter %s", filter.Name())
+	}
+
+	return nil
+}
+
+// Name identifies the filter. It is used in the notifications.
+func (filter *Filter) Name() string {
+	if filter.Field == "" || filter.Field == FilterFieldTitle {
+		return filter.Expression
+	}
+
+	return filter.Field + ":" + filter.Expression
+}
+
+// Match returns true if the item matches the filter.
+func (filter *Filter) Match(item *rss.Item) bool {
+	return filter.compiled.match(item)
+}
+
+// validatePrimaryFilter checks the rule that picks the primary filter.
+func validatePrimaryFilter(rule string) error {
+	switch rule {
+	case "", PrimaryFilterFirst, PrimaryFilterLongest, PrimaryFilterPriority:
+		return nil
+	default:
+		return errgo.New("unknown primary filter rule " + rule)
+	}
+}
+
+// primaryFilter picks the primary filter out of the given matching filters
+// with the given rule. The filters have to be in config order.
+func primaryFilter(rule string, filters []*Filter) *Filter {
+	primary := filters[0]
+	for _, filter := range filters[1:] {
+		switch rule {
+		case PrimaryFilterLongest:
+			if len(filter.Expression) > len(primary.Expression) {
+				primary = filter
+			}
+		case PrimaryFilterPriority:
+			if filter.Priority > primary.Priority {
+				primary = filter
+			}
+		}
+	}
+
+	return primary
+}
+
+// itemFields returns the values of the given field of the item.
+func itemFields(field string, item *rss.Item) ([]string, error) {
+	switch field {
+	case "", FilterFieldTitle:
+		return []string{item.Title}, nil
+	case FilterFieldSummary:
+		return []string{item.Summary}, nil
+	case FilterFieldContent:
+		return []string{item.Content}, nil
+	case FilterFieldLink:
+		return []string{item.Link}, nil
+	case FilterFieldAuthor:
+		return []string{item.Author}, nil
+	case FilterFieldCategory:
+		return item.Categories, nil
+	case FilterFieldEnclosure:
+		return enclosureFields(item), nil
+	case FilterFieldAny:
+		values := []string{item.Title, item.Summary, item.Content, item.Link, item.Author}
+		values = append(values, item.Categories...)
+		return append(values, enclosureFields(item)...), nil
+	default:
+		return nil, errgo.New("unknown filter field " + field)
+	}
+}
+
+// enclosureFields returns the urls and types of the enclosures of the item.
+func enclosureFields(item *rss.Item) []string {
+	var values []string
+	for _, enclosure := range item.Enclosures {
+		values = append(values, enclosure.URL, enclosure.Type)
+	}
+
+	return values
+}
+
+func (filter *Filter) UnmarshalJSON(data []byte) error {
+	var expression string
+	err := json.Unmarshal(data, &expression)
+	if err == nil {
+		filter.Expression = expression
+		return nil
+	}
+
+	type plain Filter
+	return json.Unmarshal(data, (*plain)(filter))
+}
+
+func (filter Filter) MarshalJSON() ([]byte, error) {
+	if filter.Field == "" && len(filter.Notifiers) == 0 && filter.Priority == 0 &&
+		filter.Sieve == nil {
+		return json.Marshal(filter.Expression)
+	}
+
+	type plain Filter
+	return json.Marshal(plain(filter))
+}
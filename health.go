@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"html"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/AlexanderThaller/logger"
+	rss "github.com/AlexanderThaller/rss-1"
+	"github.com/juju/errgo"
+)
+
+const (
+	// AlertFilter is used as the filter of alerts about broken feeds.
+	AlertFilter = "alert"
+
+	DefaultFeedAlertThreshold = 5
+	DefaultFeedBackoffMin     = time.Minute
+	DefaultFeedBackoffMax     = 6 * time.Hour
+)
+
+// FeedStatus is the health record of a feed. It is saved in the DataFolder
+// so failures are still known after a restart.
+type FeedStatus struct {
+	LastFetch   time.Time
+	LastSuccess time.Time
+	LastError   string `json:",omitempty"`
+	Failures    int    `json:",omitempty"`
+	Alerted     bool   `json:",omitempty"`
+}
+
+// validateFeedBackoff checks the durations that are used to retry broken
+// feeds.
+func validateFeedBackoff(conf *Config) error {
+	for _, duration := range []string{conf.FeedBackoffMin, conf.FeedBackoffMax} {
+		_, err := parseDurationDefault(duration, 0)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// retryDelay returns how long to wait before the feed is fetched again after
+// the given number of failures in a row.
+func (feed *Feed) retryDelay(failures int) time.Duration {
+	conf := feed.Config()
+
+	min, err := parseDurationDefault(conf.FeedBackoffMin, DefaultFeedBackoffMin)
+	if err != nil {
+		min = DefaultFeedBackoffMin
+	}
+
+	max, err := parseDurationDefault(conf.FeedBackoffMax, DefaultFeedBackoffMax)
+	if err != nil {
+		max = DefaultFeedBackoffMax
+	}
+
+	return exponentialBackoff(min, max, failures)
+}
+
+// record updates the health record of the feed with the result of a fetch
+// and saves it. If the feed failed more often in a row than the alert
+// threshold an alert is sent once until the feed works again.
+func (feed *Feed) record(fetchErr error) FeedStatus {
+	l := logger.New(name, "Feed", "record", feed.Url)
+
+	now := time.Now()
+
+	feed.lock.Lock()
+	status := feed.status
+	status.LastFetch = now
+	if fetchErr == nil {
+		status.LastSuccess = now
+		status.LastError = ""
+		status.Failures = 0
+		status.Alerted = false
+	} else {
+		status.LastError = fetchErr.Error()
+		status.Failures++
+	}
+
+	threshold := feed.config.FeedAlertThreshold
+	if threshold <= 0 {
+		threshold = DefaultFeedAlertThreshold
+	}
+
+	alert := status.Failures >= threshold && !status.Alerted
+	if alert {
+		status.Alerted = true
+	}
+
+	feed.status = status
+	datafolder := feed.config.DataFolder
+	feed.lock.Unlock()
+
+	err := feed.SaveHealth(datafolder, status)
+	if err != nil {
+		l.Warning("Can not save health record: ", errgo.Details(err))
+	}
+
+	if alert {
+		l.Notice("Feed failed ", status.Failures, " times in a row, sending alert")
+		feed.Alert(status)
+	}
+
+	return status
+}
+
+// Alert sends a notification about the broken feed to the notifiers of the
+// feed.
+func (feed *Feed) Alert(status FeedStatus) {
+	content := "Last error: " + html.EscapeString(status.LastError)
+	if !status.LastSuccess.IsZero() {
+		content += "<br>\nLast success: " + status.LastSuccess.Format(time.RFC1123)
+	}
+
+	feed.lock.RLock()
+	alert := &Item{
+		Filter: AlertFilter,
+		Folder: feed.Folder,
+		feed:   feed,
+		data: &rss.Item{
+			Title:   "Feed failed " + strconv.Itoa(status.Failures) + " times in a row",
+			Content: content,
+			Link:    feed.Url,
+			Date:    status.LastFetch,
+			ID:      feed.Url + "#alert-" + strconv.FormatInt(status.LastFetch.UnixNano(), 10),
+		},
+	}
+	notifiers := feed.digest
+	feed.lock.RUnlock()
+
+	feed.Notify(alert, notifiers)
+}
+
+// RestoreHealth reads the health record of the feed from the DataFolder.
+func (feed *Feed) RestoreHealth(datafolder string) error {
+	data, err := ioutil.ReadFile(feed.Filename(datafolder) + ".health.json")
+	if err != nil {
+		return err
+	}
+
+	var status FeedStatus
+	err = json.Unmarshal(data, &status)
+	if err != nil {
+		return err
+	}
+
+	feed.lock.Lock()
+	feed.status = status
+	feed.lock.Unlock()
+
+	return nil
+}
+
+// SaveHealth writes the given health record of the feed to the DataFolder.
+func (feed *Feed) SaveHealth(datafolder string, status FeedStatus) error {
+	data, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(datafolder, 0755)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(feed.Filename(datafolder)+".health.json", data, 0644)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	rss "github.com/AlexanderThaller/rss-1"
+)
+
+func TestFeedHealth(t *testing.T) {
+	defer rss.CacheParsedItemIDs(rss.CacheParsedItemIDs(false))
+
+	var broken int32 = 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&broken) == 1 {
+			http.Error(w, "broken", http.StatusInternalServerError)
+			return
+		}
+
+		w.Write([]byte(testFeedData))
+	}))
+	defer server.Close()
+
+	folder, err := ioutil.TempDir("", "rsswatch-health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	items := filepath.Join(folder, "items")
+	conf := &Config{
+		DataFolder:         folder,
+		FeedAlertThreshold: 3,
+		FeedBackoffMin:     "10ms",
+		FeedBackoffMax:     "20ms",
+		Notifiers: map[string]NotifierConfig{
+			"file": {Type: NotifierTypeFile, Path: items},
+		},
+		Feeds: []Feed{{Url: server.URL, Filters: []Filter{{Expression: "First"}}}},
+	}
+
+	watcher := NewWatcher("", conf)
+	err = watcher.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Stop()
+
+	feed := watcher.feeds[server.URL]
+	wait := func(description string, done func(status FeedStatus) bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !done(feed.Status()) {
+			if time.Now().After(deadline) {
+				t.Fatal("timeout while waiting for ", description, ": ", feed.Status())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	wait("the alert", func(status FeedStatus) bool { return status.Alerted })
+
+	restored := new(Feed)
+	*restored = *feed
+	err = restored.RestoreHealth(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.Status().Failures < 3 || restored.Status().LastError == "" {
+		t.Error("health record was not saved: ", restored.Status())
+	}
+
+	atomic.StoreInt32(&broken, 0)
+	wait("the recovery", func(status FeedStatus) bool { return status.Failures == 0 })
+
+	if feed.Status().LastSuccess.IsZero() || feed.Status().Alerted {
+		t.Error("recovery was not recorded: ", feed.Status())
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, _ := ioutil.ReadFile(items)
+		if strings.Count(string(data), `"Filter":"alert"`) == 1 && strings.Contains(string(data), "First item") {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("expected one alert and the item to be delivered but got ", string(data))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFeedHealthRestore(t *testing.T) {
+	folder, err := ioutil.TempDir("", "rsswatch-health")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	conf := &Config{DataFolder: folder, SaveFeeds: true}
+	feed := new(Feed)
+	err = feed.Configure(Feed{Url: "http://localhost/saved"}, conf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feed.setData(&rss.Feed{Title: "Saved", Refresh: time.Now().Add(time.Hour)})
+	err = feed.Save(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = feed.SaveHealth(folder, FeedStatus{Failures: 2, LastError: "broken"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := new(Feed)
+	err = restored.Configure(Feed{Url: feed.Url}, conf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = restored.RestoreHealth(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fetched, err := restored.Get(conf)
+	if err != nil || fetched {
+		t.Fatal("expected the saved feed to be restored but got ", fetched, err)
+	}
+
+	if restored.Title() != "Saved" {
+		t.Error("got wrong title ", restored.Title())
+	}
+
+	if status := restored.Status(); status.Failures != 2 || !status.LastSuccess.IsZero() {
+		t.Error("restoring the feed changed the health record: ", status)
+	}
+}
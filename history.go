@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	rss "github.com/AlexanderThaller/rss-1"
+)
+
+const (
+	// DefaultHistorySize is the number of matched items every feed keeps in
+	// its history.
+	DefaultHistorySize = 100
+)
+
+// historyEntry is an item that matched a filter together with its content.
+// The history of every feed is saved in the DataFolder so the matches can be
+// served as feeds over http.
+type historyEntry struct {
+	itemEntry
+	FeedUrl    string
+	Matched    time.Time
+	Summary    string          `json:",omitempty"`
+	Content    string          `json:",omitempty"`
+	Author     string          `json:",omitempty"`
+	Categories []string        `json:",omitempty"`
+	Enclosures []rss.Enclosure `json:",omitempty"`
+}
+
+func newHistoryEntry(item *Item) historyEntry {
+	return historyEntry{
+		itemEntry:  newItemEntry(item),
+		FeedUrl:    item.feed.Url,
+		Matched:    time.Now(),
+		Summary:    item.data.Summary,
+		Content:    item.data.Content,
+		Author:     item.data.Author,
+		Categories: item.data.Categories,
+		Enclosures: item.data.Enclosures,
+	}
+}
+
+// History returns the items that matched a filter, the newest first.
+func (feed *Feed) History() []historyEntry {
+	feed.lock.RLock()
+	defer feed.lock.RUnlock()
+
+	history := make([]historyEntry, len(feed.history))
+	for i, entry := range feed.history {
+		history[len(history)-1-i] = entry
+	}
+
+	return history
+}
+
+// RestoreHistory reads the history of the feed from the DataFolder.
+func (feed *Feed) RestoreHistory(datafolder string) error {
+	history, err := readHistory(feed.Filename(datafolder))
+	if err != nil {
+		return err
+	}
+
+	feed.lock.Lock()
+	feed.history = history
+	feed.lock.Unlock()
+
+	return nil
+}
+
+// SaveHistory writes the given history of the feed to the DataFolder.
+func (feed *Feed) SaveHistory(datafolder string, history []historyEntry) error {
+	data, err := json.Marshal(history)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(datafolder, 0755)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(feed.Filename(datafolder)+".history.json", data, 0644)
+}
+
+// readHistory reads the history saved for the feed with the given filename.
+// The history is sorted from the oldest to the newest match.
+func readHistory(filename string) ([]historyEntry, error) {
+	data, err := ioutil.ReadFile(filename + ".history.json")
+	if err != nil {
+		return nil, err
+	}
+
+	var history []historyEntry
+	err = json.Unmarshal(data, &history)
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// historyByMatched sorts history entries from the newest to the oldest
+// match.
+type historyByMatched []historyEntry
+
+func (entries historyByMatched) Len() int      { return len(entries) }
+func (entries historyByMatched) Swap(i, j int) { entries[i], entries[j] = entries[j], entries[i] }
+func (entries historyByMatched) Less(i, j int) bool {
+	return entries[i].Matched.After(entries[j].Matched)
+}
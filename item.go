@@ -1,10 +1,49 @@
 package main
 
 import (
+	"strings"
+	"time"
+
 	rss "github.com/AlexanderThaller/rss-1"
 )
 
+// Item is a feed item that matched one or more filters. It is handed to the
+// notifiers. Filter is the primary filter that is used for routing the item
+// into folders and Filters lists all filters that matched.
 type Item struct {
-	Filter string
-	data   *rss.Item
+	Filter  string
+	Filters []string
+	Folder  string
+	feed    *Feed
+	data    *rss.Item
+
+	// attachments are the enclosures fetched for the mails of the item.
+	attachments        []mailAttachment
+	enclosuresPrepared bool
+}
+
+// itemEntry is the summary of an item that is written by the file notifier
+// and shown by the http api.
+type itemEntry struct {
+	Feed    string
+	Folder  string
+	Filter  string
+	Filters []string `json:",omitempty"`
+	ID      string
+	Title   string
+	Link    string
+	Date    time.Time
+}
+
+func newItemEntry(item *Item) itemEntry {
+	return itemEntry{
+		Feed:    item.feed.Title(),
+		Folder:  item.Folder,
+		Filter:  item.Filter,
+		Filters: item.Filters,
+		ID:      item.data.ID,
+		Title:   strings.TrimSpace(item.data.Title),
+		Link:    item.data.Link,
+		Date:    item.data.Date,
+	}
 }
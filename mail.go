@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/AlexanderThaller/logger"
+	"github.com/juju/errgo"
+)
+
+const (
+	// MailTLSOpportunistic will use starttls if the server offers it. If
+	// starttls fails, for example because of an untrusted certificate, the
+	// mail is sent without tls like before starttls was checked.
+	MailTLSOpportunistic = ""
+	// MailTLSNone will never use tls.
+	MailTLSNone = "none"
+	// MailTLSStartTLS will fail if the server does not offer starttls.
+	MailTLSStartTLS = "starttls"
+	// MailTLSImplicit will connect with tls right away (mostly port 465).
+	MailTLSImplicit = "tls"
+
+	MailAuthPlain = "plain"
+	MailAuthLogin = "login"
+
+	DefaultMailTimeout = 30 * time.Second
+)
+
+func sendMail(message *bytes.Buffer, conf *Config, destination string) error {
+	l := logger.New(name, "sendMail")
+
+	host, _, err := net.SplitHostPort(conf.MailServer)
+	if err != nil {
+		return err
+	}
+
+	tlsConfig, err := mailTLSConfig(conf, host)
+	if err != nil {
+		return err
+	}
+
+	conn, err := dialMail(conf, host, tlsConfig)
+	if err != nil {
+		return err
+	}
+
+	err = startMailTLS(conn, conf, tlsConfig)
+	if err != nil {
+		conn.Close()
+		if conf.MailTLS != MailTLSOpportunistic {
+			return err
+		}
+
+		l.Warning("Sending mail without tls: ", err)
+		conn, err = dialMail(conf, host, tlsConfig)
+		if err != nil {
+			return err
+		}
+	}
+	defer conn.Close()
+
+	if conf.MailUsername != "" {
+		auth, err := mailAuth(conn, conf, host)
+		if err != nil {
+			return err
+		}
+
+		err = conn.Auth(auth)
+		if err != nil {
+			return errgo.Notef(err, "auth")
+		}
+	}
+
+	err = conn.Mail(conf.MailSender)
+	if err != nil {
+		return errgo.Notef(err, "mail from")
+	}
+
+	err = conn.Rcpt(destination)
+	if err != nil {
+		return errgo.Notef(err, "rcpt to")
+	}
+
+	wc, err := conn.Data()
+	if err != nil {
+		return errgo.Notef(err, "data")
+	}
+
+	_, err = message.WriteTo(wc)
+	if err != nil {
+		wc.Close()
+		return errgo.Notef(err, "data")
+	}
+
+	err = wc.Close()
+	if err != nil {
+		return errgo.Notef(err, "data")
+	}
+
+	// The mail was accepted with the end of the data. Failing here would
+	// make the queue send it again.
+	err = conn.Quit()
+	if err != nil {
+		l.Debug("Can not quit mail session: ", err)
+	}
+
+	return nil
+}
+
+func dialMail(conf *Config, host string, tlsConfig *tls.Config) (*smtp.Client, error) {
+	err := validateMailTLS(conf.MailTLS)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := net.DialTimeout("tcp", conf.MailServer, DefaultMailTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn = &mailConn{Conn: raw, timeout: DefaultMailTimeout}
+	if conf.MailTLS == MailTLSImplicit {
+		secure := tls.Client(conn, tlsConfig)
+		err = secure.Handshake()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		// smtp.NewClient only knows the connection is secure if it gets the
+		// tls connection itself.
+		conn = secure
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// startMailTLS switches the connection to tls if the tls mode asks for
+// starttls and the server offers it.
+func startMailTLS(conn *smtp.Client, conf *Config, tlsConfig *tls.Config) error {
+	if conf.MailTLS != MailTLSOpportunistic && conf.MailTLS != MailTLSStartTLS {
+		return nil
+	}
+
+	ok, _ := conn.Extension("STARTTLS")
+	if !ok {
+		if conf.MailTLS == MailTLSStartTLS {
+			return errgo.New("mail server does not offer starttls")
+		}
+
+		return nil
+	}
+
+	err := conn.StartTLS(tlsConfig)
+	if err != nil {
+		return errgo.Notef(err, "starttls")
+	}
+
+	return nil
+}
+
+// mailConn moves the deadline of the connection before every read and write
+// so a mail server that stops answering can not block the queue while large
+// mails still get all the time they need.
+type mailConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (conn *mailConn) Read(b []byte) (int, error) {
+	conn.SetDeadline(time.Now().Add(conn.timeout))
+	return conn.Conn.Read(b)
+}
+
+func (conn *mailConn) Write(b []byte) (int, error) {
+	conn.SetDeadline(time.Now().Add(conn.timeout))
+	return conn.Conn.Write(b)
+}
+
+// validateMail checks the tls mode and the authentication mechanism of the
+// mail settings.
+func validateMail(conf *Config) error {
+	err := validateMailTLS(conf.MailTLS)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(conf.MailAuth) {
+	case "", MailAuthPlain, MailAuthLogin:
+		return nil
+	default:
+		return errgo.New("unknown mail authentication mechanism " + conf.MailAuth)
+	}
+}
+
+func validateMailTLS(mode string) error {
+	switch mode {
+	case MailTLSOpportunistic, MailTLSNone, MailTLSStartTLS, MailTLSImplicit:
+		return nil
+	default:
+		return errgo.New("unknown mail tls mode " + mode)
+	}
+}
+
+// mailTLSConfig returns the tls config for the mail server. If MailCAFile is
+// set only the certificates in that file are trusted. If MailTLSPin is set
+// the sha256 sum of the public key of the server certificate has to match it
+// and the certificate chain is not checked.
+func mailTLSConfig(conf *Config, host string) (*tls.Config, error) {
+	config := &tls.Config{ServerName: host}
+
+	if conf.MailCAFile != "" {
+		data, err := ioutil.ReadFile(conf.MailCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, errgo.New("no certificates found in " + conf.MailCAFile)
+		}
+
+		config.RootCAs = pool
+	}
+
+	if conf.MailTLSPin != "" {
+		pin := strings.ToLower(strings.Replace(conf.MailTLSPin, ":", "", -1))
+
+		config.InsecureSkipVerify = true
+		config.VerifyPeerCertificate = func(certificates [][]byte, _ [][]*x509.Certificate) error {
+			if len(certificates) == 0 {
+				return errgo.New("mail server did not send a certificate")
+			}
+
+			certificate, err := x509.ParseCertificate(certificates[0])
+			if err != nil {
+				return err
+			}
+
+			sum := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+			if hex.EncodeToString(sum[:]) != pin {
+				return errgo.New("mail server certificate does not match the pin")
+			}
+
+			return nil
+		}
+	}
+
+	return config, nil
+}
+
+func mailAuth(conn *smtp.Client, conf *Config, host string) (smtp.Auth, error) {
+	mechanism := strings.ToLower(conf.MailAuth)
+	if mechanism == "" {
+		ok, mechanisms := conn.Extension("AUTH")
+		if !ok {
+			return nil, errgo.New("mail server does not support authentication")
+		}
+
+		for _, offered := range strings.Fields(strings.ToLower(mechanisms)) {
+			if offered == MailAuthPlain {
+				mechanism = MailAuthPlain
+				break
+			}
+
+			if offered == MailAuthLogin {
+				mechanism = MailAuthLogin
+			}
+		}
+	}
+
+	switch mechanism {
+	case MailAuthPlain:
+		return smtp.PlainAuth("", conf.MailUsername, conf.MailPassword, host), nil
+	case MailAuthLogin:
+		return &loginAuth{conf.MailUsername, conf.MailPassword, host}, nil
+	default:
+		return nil, errgo.New("no supported mail authentication mechanism: " + mechanism)
+	}
+}
+
+// loginAuth implements the LOGIN authentication mechanism. Like
+// smtp.PlainAuth it will only send the credentials over tls or to localhost.
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (auth *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	local := auth.host == "localhost" || auth.host == "127.0.0.1" || auth.host == "::1"
+	if !server.TLS && !local {
+		return "", nil, errgo.New("unencrypted connection")
+	}
+
+	if server.Name != auth.host {
+		return "", nil, errgo.New("wrong host name")
+	}
+
+	return "LOGIN", nil, nil
+}
+
+func (auth *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(auth.username), nil
+	case "password:":
+		return []byte(auth.password), nil
+	default:
+		return nil, errgo.New("unexpected server challenge: " + string(fromServer))
+	}
+}
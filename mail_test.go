@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpServer is a minimal in-process smtp server that accepts mails from
+// clients authenticated as test/secret.
+type smtpServer struct {
+	listener net.Listener
+	tls      *tls.Config
+	startTLS bool
+	mails    chan string
+}
+
+func newSMTPServer(t *testing.T, tlsConfig *tls.Config, implicit bool) *smtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if implicit {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	server := &smtpServer{
+		listener: listener,
+		tls:      tlsConfig,
+		startTLS: tlsConfig != nil && !implicit,
+		mails:    make(chan string, 10),
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go server.serve(conn)
+		}
+	}()
+
+	return server
+}
+
+func (server *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ready")
+
+	secure := !server.startTLS
+	authenticated := false
+	hangup := false
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch command {
+		case "EHLO":
+			text.PrintfLine("250-localhost")
+			if !secure {
+				text.PrintfLine("250-STARTTLS")
+			}
+			text.PrintfLine("250 AUTH PLAIN LOGIN")
+		case "STARTTLS":
+			text.PrintfLine("220 ready for tls")
+			conn = tls.Server(conn, server.tls)
+			text = textproto.NewConn(conn)
+			secure = true
+		case "AUTH":
+			authenticated = server.auth(text, line)
+			if authenticated {
+				text.PrintfLine("235 authenticated")
+			} else {
+				text.PrintfLine("535 authentication failed")
+			}
+		case "MAIL":
+			if !authenticated {
+				text.PrintfLine("530 authentication required")
+				continue
+			}
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			if strings.Contains(line, "rejected@") {
+				text.PrintfLine("550 no such user")
+				continue
+			}
+			hangup = strings.Contains(line, "hangup@")
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			server.mails <- string(data)
+			text.PrintfLine("250 queued")
+		case "QUIT":
+			if hangup {
+				return
+			}
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("250 ok")
+		}
+	}
+}
+
+func (server *smtpServer) auth(text *textproto.Conn, line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return false
+	}
+
+	switch strings.ToUpper(fields[1]) {
+	case "PLAIN":
+		if len(fields) < 3 {
+			return false
+		}
+
+		credentials, _ := base64.StdEncoding.DecodeString(fields[2])
+		return string(credentials) == "\x00test\x00secret"
+	case "LOGIN":
+		answers := make([]string, 0, 2)
+		for _, challenge := range []string{"Username:", "Password:"} {
+			text.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(challenge)))
+			answer, err := text.ReadLine()
+			if err != nil {
+				return false
+			}
+
+			decoded, _ := base64.StdEncoding.DecodeString(answer)
+			answers = append(answers, string(decoded))
+		}
+
+		return answers[0] == "test" && answers[1] == "secret"
+	}
+
+	return false
+}
+
+// testCertificatePin returns the pin of the test certificate and the path to
+// a ca file that contains it.
+func testCertificatePin(t *testing.T, serverTLS *tls.Config) (string, string) {
+	der := serverTLS.Certificates[0].Certificate[0]
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+
+	file, err := ioutil.TempFile("", "rsswatch-ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	err = pem.Encode(file, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hex.EncodeToString(sum[:]), file.Name()
+}
+
+func TestSendMail(t *testing.T) {
+	serverTLS, _ := testCertificate(t)
+	pin, cafile := testCertificatePin(t, serverTLS)
+	defer os.Remove(cafile)
+
+	tests := []struct {
+		name     string
+		mode     string
+		auth     string
+		implicit bool
+		pin      string
+		cafile   string
+	}{
+		{"starttls plain", MailTLSStartTLS, MailAuthPlain, false, pin, ""},
+		{"starttls login", MailTLSStartTLS, MailAuthLogin, false, pin, ""},
+		{"starttls cafile", MailTLSStartTLS, "", false, "", cafile},
+		{"opportunistic", MailTLSOpportunistic, "", false, pin, ""},
+		{"opportunistic untrusted", MailTLSOpportunistic, "", false, "", ""},
+		{"implicit", MailTLSImplicit, "", true, "", cafile},
+	}
+
+	for _, test := range tests {
+		server := newSMTPServer(t, serverTLS, test.implicit)
+		defer server.listener.Close()
+
+		conf := &Config{
+			MailAuth:     test.auth,
+			MailCAFile:   test.cafile,
+			MailPassword: "secret",
+			MailSender:   "rsswatch@localhost",
+			MailServer:   strings.Replace(server.listener.Addr().String(), "127.0.0.1", "localhost", 1),
+			MailTLS:      test.mode,
+			MailTLSPin:   test.pin,
+			MailUsername: "test",
+		}
+
+		err := sendMail(bytes.NewBufferString("Subject: test\r\n\r\nbody\r\n"), conf, "user@localhost")
+		if err != nil {
+			t.Error(test.name, ": can not send mail: ", err)
+			continue
+		}
+
+		mail := <-server.mails
+		if !strings.Contains(mail, "body") {
+			t.Error(test.name, ": got wrong mail: ", mail)
+		}
+	}
+}
+
+func TestSendMailQuit(t *testing.T) {
+	server := newSMTPServer(t, nil, false)
+	defer server.listener.Close()
+
+	conf := &Config{
+		MailPassword: "secret",
+		MailSender:   "rsswatch@localhost",
+		MailServer:   server.listener.Addr().String(),
+		MailTLS:      MailTLSNone,
+		MailUsername: "test",
+	}
+
+	// The mail was accepted so a failed quit must not make the queue send it
+	// again.
+	err := sendMail(bytes.NewBufferString("body\r\n"), conf, "hangup@localhost")
+	if err != nil {
+		t.Error("expected the accepted mail to be sent but got ", err)
+	}
+
+	if mail := <-server.mails; !strings.Contains(mail, "body") {
+		t.Error("got wrong mail: ", mail)
+	}
+}
+
+func TestSendMailErrors(t *testing.T) {
+	serverTLS, _ := testCertificate(t)
+	pin, cafile := testCertificatePin(t, serverTLS)
+	os.Remove(cafile)
+
+	server := newSMTPServer(t, serverTLS, false)
+	defer server.listener.Close()
+
+	address := strings.Replace(server.listener.Addr().String(), "127.0.0.1", "localhost", 1)
+
+	tests := map[string]struct {
+		conf        Config
+		destination string
+	}{
+		"wrong pin": {
+			Config{MailServer: address, MailTLS: MailTLSStartTLS, MailTLSPin: "00",
+				MailUsername: "test", MailPassword: "secret"},
+			"user@localhost",
+		},
+		"wrong password": {
+			Config{MailServer: address, MailTLS: MailTLSStartTLS, MailTLSPin: pin,
+				MailUsername: "test", MailPassword: "wrong"},
+			"user@localhost",
+		},
+		"untrusted certificate": {
+			Config{MailServer: address, MailTLS: MailTLSStartTLS,
+				MailUsername: "test", MailPassword: "secret"},
+			"user@localhost",
+		},
+		"rejected recipient": {
+			Config{MailServer: address, MailTLS: MailTLSNone,
+				MailUsername: "test", MailPassword: "secret"},
+			"rejected@localhost",
+		},
+		"not authenticated": {
+			Config{MailServer: address, MailTLS: MailTLSNone},
+			"user@localhost",
+		},
+	}
+
+	for name, test := range tests {
+		err := sendMail(bytes.NewBufferString("body\r\n"), &test.conf, test.destination)
+		if err == nil {
+			t.Error(name, ": expected an error")
+		}
+	}
+}
+
+func TestMailConnTimeout(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+
+	conn := &mailConn{Conn: client, timeout: 10 * time.Millisecond}
+	defer conn.Close()
+
+	_, err := conn.Read(make([]byte, 1))
+	if err, ok := err.(net.Error); !ok || !err.Timeout() {
+		t.Error("expected a timeout from a stalled server but got ", err)
+	}
+}
+
+func TestValidateMail(t *testing.T) {
+	tests := []struct {
+		mode  string
+		auth  string
+		valid bool
+	}{
+		{MailTLSOpportunistic, "", true},
+		{MailTLSImplicit, "LOGIN", true},
+		{MailTLSStartTLS, MailAuthPlain, true},
+		{"ssl", "", false},
+		{MailTLSNone, "cram-md5", false},
+	}
+
+	for _, test := range tests {
+		err := validateMail(&Config{MailTLS: test.mode, MailAuth: test.auth})
+		if (err == nil) != test.valid {
+			t.Errorf("%q %q: expected valid to be %v but got %v", test.mode, test.auth, test.valid, err)
+		}
+	}
+}
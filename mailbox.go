@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MailboxRoot is the mailbox all items are filed under. It is the same one
+// rss.sieve uses.
+const MailboxRoot = "rss"
+
+var mailboxSequence uint64
+
+// mailboxName returns the mailbox rss.sieve files a message into. That is
+// the root followed by the folder, feed and filter headers separated by dots.
+// Empty headers are left out.
+func mailboxName(folder, feed, filter string) string {
+	segments := []string{MailboxRoot}
+	for _, segment := range []string{folder, feed, filter} {
+		segment = strings.Replace(strings.TrimSpace(segment), "/", "_", -1)
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+
+	return strings.Join(segments, ".")
+}
+
+// messageMailbox reads the headers of the message and returns the mailbox
+// for it.
+func messageMailbox(message *mail.Message) (string, error) {
+	decoder := new(mime.WordDecoder)
+
+	var values []string
+	for _, headerName := range []string{"Folder", "Feed", "Filter"} {
+		value, err := decoder.DecodeHeader(message.Header.Get(headerName))
+		if err != nil {
+			return "", err
+		}
+
+		values = append(values, value)
+	}
+
+	return mailboxName(values[0], values[1], values[2]), nil
+}
+
+// deliverMaildir writes the message into the Maildir++ folder of its
+// mailbox below the given maildir. Missing folders are created.
+func deliverMaildir(maildir string, payload []byte) error {
+	message, err := mail.ReadMessage(bytes.NewReader(payload))
+	if err != nil {
+		return &queueError{error: err, Permanent: true}
+	}
+
+	mailbox, err := messageMailbox(message)
+	if err != nil {
+		return &queueError{error: err, Permanent: true}
+	}
+
+	folder := filepath.Join(maildir, "."+mailbox)
+	for _, path := range []string{maildir, folder} {
+		for _, sub := range []string{"cur", "new", "tmp"} {
+			err = os.MkdirAll(filepath.Join(path, sub), 0700)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = ioutil.WriteFile(filepath.Join(folder, "maildirfolder"), nil, 0600)
+	if err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+	hostname = strings.NewReplacer("/", `\057`, ":", `\072`).Replace(hostname)
+	now := time.Now()
+	filename := fmt.Sprintf("%d.M%dP%dQ%d.%s", now.Unix(), now.Nanosecond()/1000, os.Getpid(),
+		atomic.AddUint64(&mailboxSequence, 1), hostname)
+
+	temporary := filepath.Join(folder, "tmp", filename)
+	err = ioutil.WriteFile(temporary, unixLineEndings(payload), 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(temporary, filepath.Join(folder, "new", filename))
+}
+
+var mboxLock sync.Mutex
+
+// deliverMbox appends the message to the mbox file of its mailbox in the
+// given folder. Lines starting with From are quoted as described for the
+// mboxrd format.
+func deliverMbox(folder string, payload []byte) error {
+	message, err := mail.ReadMessage(bytes.NewReader(payload))
+	if err != nil {
+		return &queueError{error: err, Permanent: true}
+	}
+
+	mailbox, err := messageMailbox(message)
+	if err != nil {
+		return &queueError{error: err, Permanent: true}
+	}
+
+	sender := "MAILER-DAEMON"
+	address, err := mail.ParseAddress(message.Header.Get("From"))
+	if err == nil {
+		sender = address.Address
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString("From " + sender + " " + time.Now().UTC().Format(time.ANSIC) + "\n")
+	for _, line := range strings.SplitAfter(string(unixLineEndings(payload)), "\n") {
+		if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+			buffer.WriteString(">")
+		}
+		buffer.WriteString(line)
+	}
+	if !bytes.HasSuffix(buffer.Bytes(), []byte("\n")) {
+		buffer.WriteString("\n")
+	}
+	buffer.WriteString("\n")
+
+	err = os.MkdirAll(folder, 0700)
+	if err != nil {
+		return err
+	}
+
+	mboxLock.Lock()
+	defer mboxLock.Unlock()
+
+	return appendFile(filepath.Join(folder, mailbox), buffer.Bytes())
+}
+
+func unixLineEndings(data []byte) []byte {
+	return bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+}
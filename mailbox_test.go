@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	rss "github.com/AlexanderThaller/rss-1"
+)
+
+func TestMailboxName(t *testing.T) {
+	tests := []struct {
+		folder, feed, filter string
+		expected             string
+	}{
+		{"news", "Go Blog", "Go", "rss.news.Go Blog.Go"},
+		{"news.go", "Go Blog", "", "rss.news.go.Go Blog"},
+		{"", "a/b", "", "rss.a_b"},
+	}
+
+	for _, test := range tests {
+		mailbox := mailboxName(test.folder, test.feed, test.filter)
+		if mailbox != test.expected {
+			t.Errorf("expected mailbox %q but got %q", test.expected, mailbox)
+		}
+	}
+}
+
+func TestLocalMailNotifiers(t *testing.T) {
+	folder, err := ioutil.TempDir("", "rsswatch-mailbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	conf := &Config{
+		DataFolder: folder,
+		MailSender: "rsswatch@example.org",
+		Notifiers: map[string]NotifierConfig{
+			"maildir": {Type: NotifierTypeMaildir, Path: filepath.Join(folder, "Maildir")},
+			"mbox":    {Type: NotifierTypeMbox, Path: filepath.Join(folder, "mail")},
+		},
+	}
+
+	notifiers, err := launchNotifiers(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stopNotifiers(notifiers)
+
+	feed := &Feed{Url: "http://localhost/feed"}
+	err = feed.Configure(Feed{
+		Url:     feed.Url,
+		Folder:  "news",
+		Filters: []Filter{{Expression: "Go"}, {Expression: ".*"}},
+	}, conf, notifiers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed.data = &rss.Feed{Title: "Go Blog"}
+
+	items := []*rss.Item{
+		{ID: "go", Title: "Go", Content: "Release\nFrom the blog"},
+		{ID: "rust", Title: "Rust", Content: "Release"},
+		{ID: "go-again", Title: "Go again", Content: "Release"},
+	}
+	for _, item := range items {
+		feed.Send(item)
+	}
+
+	for _, notifier := range notifiers {
+		err = notifier.Drain()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for mailbox, count := range map[string]int{"rss.news.Go Blog.Go": 2, "rss.news.Go Blog": 1} {
+		files, err := ioutil.ReadDir(filepath.Join(folder, "Maildir", "."+mailbox, "new"))
+		if err != nil || len(files) != count {
+			t.Errorf("expected %d messages in maildir folder %s but got %d: %v", count, mailbox,
+				len(files), err)
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(folder, "mail", mailbox))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.HasPrefix(string(data), "From rsswatch@example.org ") ||
+			strings.Count(string(data), "\nFrom ") != count-1 {
+			t.Errorf("expected %d messages in mbox %s but got:\n%s", count, mailbox, data)
+		}
+
+		if strings.Contains(string(data), "\r\n") {
+			t.Errorf("mbox %s contains crlf line endings", mailbox)
+		}
+
+		if mailbox == "rss.news.Go Blog.Go" && !strings.Contains(string(data), "\n>From the blog") {
+			t.Errorf("expected from lines to be quoted in mbox %s but got:\n%s", mailbox, data)
+		}
+	}
+
+	for _, path := range []string{"cur", "new", "tmp"} {
+		if _, err := os.Stat(filepath.Join(folder, "Maildir", path)); err != nil {
+			t.Error("maildir was not created: ", err)
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// mailMessage is a multipart/alternative mail with a plain text and an html
+// part. If the message has attachments it is wrapped in a multipart/mixed
+// mail together with them. The headers are written in the order they were
+// added.
+type mailMessage struct {
+	headers     []mailHeader
+	text        string
+	html        string
+	attachments []mailAttachment
+}
+
+type mailAttachment struct {
+	filename    string
+	contentType string
+	data        []byte
+}
+
+type mailHeader struct {
+	name  string
+	value string
+}
+
+// Add adds a header. Line breaks in the value are replaced with spaces.
+func (message *mailMessage) Add(headerName, value string) {
+	value = strings.Join(strings.FieldsFunc(value, func(r rune) bool {
+		return r == '\r' || r == '\n'
+	}), " ")
+
+	message.headers = append(message.headers, mailHeader{headerName, value})
+}
+
+// Attach adds a file to the message.
+func (message *mailMessage) Attach(filename, contentType string, data []byte) {
+	message.attachments = append(message.attachments, mailAttachment{filename, contentType, data})
+}
+
+// WriteTo writes the message with the headers encoded as described in rfc
+// 2047, both parts encoded as quoted-printable and the attachments encoded
+// as base64.
+func (message *mailMessage) WriteTo(buffer *bytes.Buffer) error {
+	var alternative bytes.Buffer
+	contentType, err := message.writeAlternative(&alternative)
+	if err != nil {
+		return err
+	}
+
+	body := &alternative
+	if len(message.attachments) != 0 {
+		body = new(bytes.Buffer)
+		contentType, err = message.writeMixed(body, contentType, alternative.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, header := range message.headers {
+		value := encodeHeader(header.value)
+		if addressHeaders[header.name] {
+			value = encodeAddresses(header.value)
+		}
+
+		buffer.WriteString(header.name + ": " + value + "\r\n")
+	}
+	buffer.WriteString("MIME-Version: 1.0\r\n")
+	buffer.WriteString("Content-Type: " + contentType + "\r\n")
+	buffer.WriteString("\r\n")
+	body.WriteTo(buffer)
+
+	return nil
+}
+
+// writeAlternative writes the text and the html part and returns the
+// content type of the written body.
+func (message *mailMessage) writeAlternative(body *bytes.Buffer) (string, error) {
+	parts := multipart.NewWriter(body)
+
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", message.text},
+		{"text/html; charset=utf-8", message.html},
+	} {
+		writer, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return "", err
+		}
+
+		encoder := quotedprintable.NewWriter(writer)
+		_, err = encoder.Write([]byte(part.content))
+		if err != nil {
+			return "", err
+		}
+
+		err = encoder.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err := parts.Close()
+	if err != nil {
+		return "", err
+	}
+
+	return "multipart/alternative; boundary=" + parts.Boundary(), nil
+}
+
+// writeMixed writes the already written alternative body followed by the
+// attachments and returns the content type of the written body.
+func (message *mailMessage) writeMixed(body *bytes.Buffer, alternativeType string, alternative []byte) (string, error) {
+	parts := multipart.NewWriter(body)
+
+	writer, err := parts.CreatePart(textproto.MIMEHeader{"Content-Type": {alternativeType}})
+	if err != nil {
+		return "", err
+	}
+
+	_, err = writer.Write(alternative)
+	if err != nil {
+		return "", err
+	}
+
+	for _, attachment := range message.attachments {
+		contentType := attachment.contentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		writer, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition": {mime.FormatMediaType("attachment",
+				map[string]string{"filename": attachment.filename})},
+		})
+		if err != nil {
+			return "", err
+		}
+
+		encoded := base64.StdEncoding.EncodeToString(attachment.data)
+		for len(encoded) > 76 {
+			writer.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		_, err = writer.Write([]byte(encoded + "\r\n"))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = parts.Close()
+	if err != nil {
+		return "", err
+	}
+
+	return "multipart/mixed; boundary=" + parts.Boundary(), nil
+}
+
+// encodeHeader encodes values that are not plain ascii and folds the encoded
+// words onto their own lines so that no line gets too long.
+func encodeHeader(value string) string {
+	encoded := mime.QEncoding.Encode("utf-8", value)
+	return strings.Replace(encoded, "?= =?", "?=\r\n =?", -1)
+}
+
+// addressHeaders are the headers that hold a list of addresses.
+var addressHeaders = map[string]bool{
+	"From":     true,
+	"To":       true,
+	"Cc":       true,
+	"Reply-To": true,
+}
+
+// encodeAddresses encodes only the display names of the addresses as the
+// addresses themselves have to stay readable. Values that are no valid
+// address list are encoded like every other header.
+func encodeAddresses(value string) string {
+	addresses, err := mail.ParseAddressList(value)
+	if err != nil {
+		return encodeHeader(value)
+	}
+
+	var encoded []string
+	for _, address := range addresses {
+		if address.Name == "" {
+			encoded = append(encoded, address.Address)
+			continue
+		}
+
+		encoded = append(encoded, (&mail.Address{Name: address.Name, Address: address.Address}).String())
+	}
+
+	return strings.Join(encoded, ", ")
+}
+
+// messageID returns a message id that is always the same for the given
+// parts. It is used to give every item of a feed a stable id and to thread
+// them with the id of the feed.
+func messageID(sender string, parts ...string) string {
+	hash := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+
+	domain := strings.ToLower(name)
+	address, err := mail.ParseAddress(sender)
+	if err == nil && strings.Contains(address.Address, "@") {
+		domain = address.Address[strings.LastIndex(address.Address, "@")+1:]
+	}
+
+	return "<" + hex.EncodeToString(hash[:16]) + "@" + domain + ">"
+}
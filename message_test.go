@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+
+	rss "github.com/AlexanderThaller/rss-1"
+)
+
+// readMessage parses a generated mail and returns its decoded headers and
+// the decoded parts by content type with plain line breaks.
+func readMessage(t *testing.T, data []byte) (mail.Header, map[string]string) {
+	message, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := make(mail.Header)
+	decoder := new(mime.WordDecoder)
+	for key, values := range message.Header {
+		for _, value := range values {
+			decoded, err := decoder.DecodeHeader(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			header[key] = append(header[key], decoded)
+		}
+	}
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediaType != "multipart/alternative" {
+		t.Fatal("expected a multipart/alternative message but got ", mediaType)
+	}
+
+	parts := make(map[string]string)
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := reader.NextRawPart()
+		if err != nil {
+			break
+		}
+
+		content, err := ioutil.ReadAll(quotedprintable.NewReader(part))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		partType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		parts[partType] = strings.Replace(string(content), "\r\n", "\n", -1)
+	}
+
+	return header, parts
+}
+
+func TestGenerateMessage(t *testing.T) {
+	conf := &Config{MailSender: "RSS Wätcher <rsswatch@example.org>"}
+	feed := new(Feed)
+	err := feed.Configure(Feed{
+		Url:     "http://localhost/feed",
+		Filters: []Filter{{Expression: "Über"}},
+		Folder:  "news",
+	}, conf, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := feed.Filter(&rss.Item{ID: "first", Title: "Über " + strings.Repeat("lange ", 20) + "Titel"})
+	second := feed.Filter(&rss.Item{ID: "second", Title: "Über"})
+
+	data, err := feed.GenerateMessage(first, "admin@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range strings.Split(data.String(), "\r\n") {
+		if len(line) > 998 {
+			t.Errorf("line is longer than 998 characters: %q", line)
+		}
+
+		for _, r := range line {
+			if r > 127 {
+				t.Fatalf("line contains non ascii characters: %q", line)
+			}
+		}
+	}
+
+	header, parts := readMessage(t, data.Bytes())
+	for key, expected := range map[string]string{
+		"Subject":      "Über " + strings.Repeat("lange ", 20) + "Titel",
+		"From":         "RSS Wätcher <rsswatch@example.org>",
+		"To":           "admin@example.org",
+		"Mime-Version": "1.0",
+		"Folder":       "news",
+		"Filter":       "Über",
+	} {
+		if header.Get(key) != expected {
+			t.Errorf("expected %s header %q but got %q", key, expected, header.Get(key))
+		}
+	}
+
+	if _, err := header.Date(); err != nil {
+		t.Error("invalid date header: ", err)
+	}
+
+	// Only the display name may be encoded so the address stays readable.
+	raw, err := mail.ReadMessage(bytes.NewReader(data.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sender, err := mail.ParseAddress(raw.Header.Get("From"))
+	if err != nil || sender.Name != "RSS Wätcher" || sender.Address != "rsswatch@example.org" {
+		t.Errorf("invalid from header %q: %v", raw.Header.Get("From"), err)
+	}
+
+	if !strings.Contains(parts["text/plain"], "Über") || !strings.Contains(parts["text/html"], "Über") {
+		t.Errorf("expected the title in both parts but got %q", parts)
+	}
+
+	again, err := feed.GenerateMessage(first, "admin@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := feed.GenerateMessage(second, "admin@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	againHeader, _ := readMessage(t, again.Bytes())
+	otherHeader, _ := readMessage(t, other.Bytes())
+
+	id := header.Get("Message-Id")
+	if !strings.HasSuffix(id, "@example.org>") || againHeader.Get("Message-Id") != id {
+		t.Errorf("expected a stable message id but got %q and %q", id, againHeader.Get("Message-Id"))
+	}
+
+	if otherHeader.Get("Message-Id") == id {
+		t.Error("different items got the same message id")
+	}
+
+	if header.Get("References") == "" || otherHeader.Get("References") != header.Get("References") {
+		t.Errorf("expected all items to reference the feed but got %q and %q",
+			header.Get("References"), otherHeader.Get("References"))
+	}
+}
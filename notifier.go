@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"sort"
+
+	"github.com/juju/errgo"
+)
+
+const (
+	NotifierTypeMail    = "mail"
+	NotifierTypeXmpp    = "xmpp"
+	NotifierTypeFile    = "file"
+	NotifierTypeWebhook = "webhook"
+	NotifierTypeMaildir = "maildir"
+	NotifierTypeMbox    = "mbox"
+)
+
+// Notifier gets called for every item that matched a filter of a feed.
+// Drain waits until all items that were handed to the notifier are
+// delivered.
+type Notifier interface {
+	Notify(item *Item) error
+	Drain() error
+	Stop()
+}
+
+// NotifierConfig declares a named notifier. Destination overwrites the
+// globally configured mail or xmpp destination, Path is the file the file
+// notifier will append to, the maildir the maildir notifier delivers to or
+// the folder the mbox notifier keeps its mbox files in. Url, Secret,
+// Template, ContentType and Timeout configure the webhook notifier.
+// ContentType is the content type of the templated body and defaults to
+// json.
+type NotifierConfig struct {
+	Type        string
+	Destination string `json:",omitempty"`
+	Path        string `json:",omitempty"`
+	Url         string `json:",omitempty"`
+	Secret      string `json:",omitempty"`
+	Template    string `json:",omitempty"`
+	ContentType string `json:",omitempty"`
+	Timeout     string `json:",omitempty"`
+}
+
+// declaredNotifiers returns the notifiers declared in the config. If no
+// notifiers are declared we will use the global mail and xmpp settings
+// instead. Older versions never used the xmpp settings so xmpp is only
+// declared if the account and the destination are set.
+func declaredNotifiers(conf *Config) map[string]NotifierConfig {
+	if len(conf.Notifiers) != 0 {
+		return conf.Notifiers
+	}
+
+	declared := make(map[string]NotifierConfig)
+	if !conf.MailDisable {
+		declared[NotifierTypeMail] = NotifierConfig{Type: NotifierTypeMail}
+	}
+
+	if !conf.XmppDisable && conf.XmppDomain != "" && conf.XmppUsername != "" &&
+		conf.XmppDestination != "" {
+		declared[NotifierTypeXmpp] = NotifierConfig{Type: NotifierTypeXmpp}
+	}
+
+	return declared
+}
+
+// launchNotifiers will start all notifiers declared in the config. If one of
+// them can not be started the ones that were already started are stopped
+// again.
+func launchNotifiers(conf *Config) (map[string]Notifier, error) {
+	declared := declaredNotifiers(conf)
+
+	var xmpp *XmppClient
+	notifiers := make(map[string]Notifier)
+	for notifierName, settings := range declared {
+		err := settings.Validate()
+		if err != nil {
+			stopNotifiers(notifiers)
+			return nil, errgo.Notef(err, "notifier %s", notifierName)
+		}
+
+		if settings.Type == NotifierTypeXmpp && xmpp == nil {
+			xmpp = NewXmppClient(conf)
+		}
+
+		notifier, err := launchNotifier(conf, notifierName, settings, xmpp)
+		if err != nil {
+			stopNotifiers(notifiers)
+			return nil, err
+		}
+
+		notifiers[notifierName] = notifier
+	}
+
+	return notifiers, nil
+}
+
+// launchNotifier starts the notifier with the given settings. All xmpp
+// notifiers share the given client.
+func launchNotifier(conf *Config, notifierName string, settings NotifierConfig, xmpp *XmppClient) (Notifier, error) {
+	switch settings.Type {
+	case NotifierTypeMail:
+		destination := settings.Destination
+		if destination == "" {
+			destination = conf.MailDestination
+		}
+
+		queue, err := launchQueue(conf, notifierName, func(payload []byte) error {
+			return sendMail(bytes.NewBuffer(payload), conf, destination)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return &MailNotifier{
+			destination: destination,
+			queue:       queue,
+		}, nil
+
+	case NotifierTypeXmpp:
+		destination := settings.Destination
+		if destination == "" {
+			destination = conf.XmppDestination
+		}
+
+		queue, err := launchQueue(conf, notifierName, func(payload []byte) error {
+			var message xmppMessage
+			err := xml.Unmarshal(payload, &message)
+			if err != nil {
+				return err
+			}
+
+			return xmpp.Send(message)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return &XmppNotifier{
+			destination: destination,
+			client:      xmpp,
+			queue:       queue,
+		}, nil
+
+	case NotifierTypeFile:
+		path := settings.Path
+		queue, err := launchQueue(conf, notifierName, func(payload []byte) error {
+			return appendFile(path, payload)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return &FileNotifier{queue: queue}, nil
+
+	case NotifierTypeMaildir, NotifierTypeMbox:
+		path := settings.Path
+		deliver := deliverMaildir
+		if settings.Type == NotifierTypeMbox {
+			deliver = deliverMbox
+		}
+
+		destination := settings.Destination
+		if destination == "" {
+			destination = conf.MailDestination
+		}
+
+		queue, err := launchQueue(conf, notifierName, func(payload []byte) error {
+			return deliver(path, payload)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return &MailNotifier{
+			destination: destination,
+			queue:       queue,
+		}, nil
+
+	case NotifierTypeWebhook:
+		return launchWebhookNotifier(conf, notifierName, settings)
+
+	default:
+		return nil, errgo.New("notifier " + notifierName +
+			" has unknown type " + settings.Type)
+	}
+}
+
+// Validate checks that the notifier has a known type and the settings that
+// its type needs.
+func (settings NotifierConfig) Validate() error {
+	switch settings.Type {
+	case NotifierTypeMail, NotifierTypeXmpp:
+		return nil
+
+	case NotifierTypeFile, NotifierTypeMaildir, NotifierTypeMbox:
+		if settings.Path == "" {
+			return errgo.New("has no path")
+		}
+
+		return nil
+
+	case NotifierTypeWebhook:
+		if settings.Url == "" {
+			return errgo.New("has no url")
+		}
+
+		_, err := parseDurationDefault(settings.Timeout, DefaultWebhookTimeout)
+		if err != nil {
+			return errgo.Notef(err, "timeout")
+		}
+
+		if settings.Template != "" {
+			_, err = compileTemplate("webhook", settings.Template)
+			if err != nil {
+				return errgo.Notef(err, "template")
+			}
+		}
+
+		err = validateWebhookContentType(settings.ContentType)
+		if err != nil {
+			return errgo.Notef(err, "content type")
+		}
+
+		return nil
+
+	default:
+		return errgo.New("has unknown type " + settings.Type)
+	}
+}
+
+// routeNotifiers returns the notifiers with the given names or all notifiers
+// if no names are given.
+func routeNotifiers(notifiers map[string]Notifier, names []string) ([]Notifier, error) {
+	if len(names) == 0 {
+		var all []string
+		for notifierName := range notifiers {
+			all = append(all, notifierName)
+		}
+		sort.Strings(all)
+
+		names = all
+	}
+
+	var out []Notifier
+	for _, notifierName := range names {
+		notifier, exists := notifiers[notifierName]
+		if !exists {
+			return nil, errgo.New("unknown notifier " + notifierName)
+		}
+
+		out = append(out, notifier)
+	}
+
+	return out, nil
+}
+
+// MailNotifier will send a mail for every item. The mail is either sent to
+// the mail server or delivered into a local maildir or mbox.
+type MailNotifier struct {
+	destination string
+	queue       *Queue
+}
+
+func (notifier *MailNotifier) Notify(item *Item) error {
+	item.feed.prepareEnclosures(item)
+
+	message, err := item.feed.GenerateMessage(item, notifier.destination)
+	if err != nil {
+		return err
+	}
+
+	return notifier.queue.Push(message.Bytes())
+}
+
+func (notifier *MailNotifier) Drain() error {
+	return notifier.queue.Drain()
+}
+
+func (notifier *MailNotifier) Stop() {
+	notifier.queue.Stop()
+}
+
+// XmppNotifier will send a chat message for every item.
+type XmppNotifier struct {
+	destination string
+	client      *XmppClient
+	queue       *Queue
+}
+
+func (notifier *XmppNotifier) Notify(item *Item) error {
+	body, err := item.feed.GenerateXmppMessage(item)
+	if err != nil {
+		return err
+	}
+
+	message, err := xml.Marshal(xmppMessage{
+		To:   notifier.destination,
+		Type: "chat",
+		Body: body,
+	})
+	if err != nil {
+		return err
+	}
+
+	return notifier.queue.Push(message)
+}
+
+func (notifier *XmppNotifier) Drain() error {
+	return notifier.queue.Drain()
+}
+
+func (notifier *XmppNotifier) Stop() {
+	notifier.queue.Stop()
+	notifier.client.Close()
+}
+
+// FileNotifier will append every item as a json object to a file.
+type FileNotifier struct {
+	queue *Queue
+}
+
+func (notifier *FileNotifier) Notify(item *Item) error {
+	entry := newItemEntry(item)
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return notifier.queue.Push(append(data, '\n'))
+}
+
+func (notifier *FileNotifier) Drain() error {
+	return notifier.queue.Drain()
+}
+
+func (notifier *FileNotifier) Stop() {
+	notifier.queue.Stop()
+}
+
+func appendFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(data)
+	return err
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	rss "github.com/AlexanderThaller/rss-1"
+)
+
+// testNotifier records the names of the notifiers that got an item.
+type testNotifier struct {
+	name     string
+	lock     *sync.Mutex
+	notified *[]string
+}
+
+func (notifier testNotifier) Notify(item *Item) error {
+	notifier.lock.Lock()
+	defer notifier.lock.Unlock()
+
+	*notifier.notified = append(*notifier.notified, notifier.name)
+	return nil
+}
+
+func (notifier testNotifier) Drain() error { return nil }
+func (notifier testNotifier) Stop()        {}
+
+func TestFeedRouteNotifiers(t *testing.T) {
+	folder, err := ioutil.TempDir("", "rsswatch-notifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	tests := []struct {
+		settings Feed
+		global   []Filter
+		expected []string
+		invalid  bool
+	}{
+		// Without any routes every notifier gets the item.
+		{Feed{Filters: []Filter{{Expression: "Go"}}}, nil, []string{"a", "b"}, false},
+		{Feed{Filters: []Filter{{Expression: "Go"}}, Notifiers: []string{"a"}}, nil, []string{"a"}, false},
+		{Feed{Filters: []Filter{{Expression: "Go", Notifiers: []string{"b"}}}, Notifiers: []string{"a"}},
+			nil, []string{"b"}, false},
+		// Every notifier gets the item once even if several filters route to it.
+		{Feed{Filters: []Filter{{Expression: "Go", Notifiers: []string{"a", "b"}},
+			{Expression: "Release", Notifiers: []string{"b"}}}}, nil, []string{"a", "b"}, false},
+		{Feed{Filters: []Filter{{Expression: "Rust", Notifiers: []string{"b"}}}, Notifiers: []string{"a"}},
+			[]Filter{{Expression: "Release"}}, []string{"a"}, false},
+		{Feed{Filters: []Filter{{Expression: "Rust"}}, Notifiers: []string{"a"}},
+			[]Filter{{Expression: "Release", Notifiers: []string{"b"}}}, []string{"b"}, false},
+		{Feed{Filters: []Filter{{Expression: "Go"}}, Notifiers: []string{"c"}}, nil, nil, true},
+		{Feed{Filters: []Filter{{Expression: "Go", Notifiers: []string{"c"}}}}, nil, nil, true},
+		{Feed{Filters: []Filter{{Expression: "Go"}}}, []Filter{{Expression: "Release", Notifiers: []string{"c"}}},
+			nil, true},
+	}
+
+	for i, test := range tests {
+		var lock sync.Mutex
+		var notified []string
+		notifiers := map[string]Notifier{
+			"a": testNotifier{name: "a", lock: &lock, notified: &notified},
+			"b": testNotifier{name: "b", lock: &lock, notified: &notified},
+		}
+
+		conf := &Config{DataFolder: folder, GlobalFilters: GlobalFilters{Include: test.global}}
+		feed := &Feed{Url: "http://localhost/feed"}
+		err := feed.Configure(test.settings, conf, notifiers)
+		if test.invalid {
+			if err == nil {
+				t.Error(i, ": expected an unknown notifier error")
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(i, ": ", err)
+		}
+
+		feed.Send(&rss.Item{ID: "go", Title: "Go Release"})
+
+		sort.Strings(notified)
+		if !reflect.DeepEqual(notified, test.expected) {
+			t.Error(i, ": expected the item to be routed to ", test.expected, " but got ", notified)
+		}
+	}
+}
+
+func TestDeclaredNotifiers(t *testing.T) {
+	tests := []struct {
+		conf     Config
+		expected []string
+	}{
+		{Config{}, []string{NotifierTypeMail}},
+		{Config{MailDisable: true, XmppDomain: "localhost"}, []string{}},
+		{Config{XmppDomain: "localhost", XmppUsername: "rsswatch", XmppDestination: "user@localhost"},
+			[]string{NotifierTypeMail, NotifierTypeXmpp}},
+		{Config{XmppDisable: true, XmppDomain: "localhost", XmppUsername: "rsswatch",
+			XmppDestination: "user@localhost"}, []string{NotifierTypeMail}},
+		{Config{Notifiers: map[string]NotifierConfig{"file": {Type: NotifierTypeFile}}}, []string{"file"}},
+	}
+
+	for _, test := range tests {
+		names := []string{}
+		for notifierName := range declaredNotifiers(&test.conf) {
+			names = append(names, notifierName)
+		}
+		sort.Strings(names)
+
+		if !reflect.DeepEqual(names, test.expected) {
+			t.Errorf("expected notifiers %v but got %v", test.expected, names)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/AlexanderThaller/logger"
+	"github.com/juju/errgo"
+)
+
+// once will fetch every feed that is due, send the notifications for the new
+// items and wait until they are delivered. It is used instead of launch when
+// running from cron or a timer. The returned error lists every feed and
+// notifier that failed.
+func once(conf *Config) error {
+	l := logger.New(name, "once")
+
+	wanted, err := validateConfig(conf)
+	if err != nil {
+		return err
+	}
+
+	notifiers, err := launchNotifiers(conf)
+	if err != nil {
+		return err
+	}
+	defer stopNotifiers(notifiers)
+
+	var failures []string
+	var lock sync.Mutex
+	var group sync.WaitGroup
+	for _, settings := range conf.Feeds {
+		if _, exists := wanted[settings.Url]; !exists {
+			l.Debug("Skipping paused feed ", settings.Url)
+			continue
+		}
+
+		feed := new(Feed)
+		*feed = settings
+		err := feed.Configure(settings, conf, notifiers)
+		if err != nil {
+			return err
+		}
+
+		group.Add(1)
+		go func() {
+			defer group.Done()
+
+			err := feed.Poll()
+			if err != nil {
+				l.Warning("Can not poll feed ", feed.Url, ": ", errgo.Details(err))
+
+				lock.Lock()
+				failures = append(failures, "feed "+feed.Url+": "+err.Error())
+				lock.Unlock()
+			}
+		}()
+	}
+	group.Wait()
+
+	l.Debug("Waiting for the notifiers")
+	for notifierName, notifier := range notifiers {
+		err := notifier.Drain()
+		if err != nil {
+			l.Warning("Can not drain notifier ", notifierName, ": ", err)
+			failures = append(failures, "notifier "+notifierName+": "+err.Error())
+		}
+	}
+
+	if len(failures) != 0 {
+		sort.Strings(failures)
+		return errgo.New(strings.Join(failures, "\n"))
+	}
+
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	rss "github.com/AlexanderThaller/rss-1"
+)
+
+func TestOnce(t *testing.T) {
+	// The parser skips item ids it has already seen in other tests.
+	defer rss.CacheParsedItemIDs(rss.CacheParsedItemIDs(false))
+
+	server := testFeedServer()
+	defer server.Close()
+
+	folder, err := ioutil.TempDir("", "rsswatch-once")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	items := filepath.Join(folder, "items")
+	conf := &Config{
+		Catchup:    Catchup{Mode: CatchupAll},
+		DataFolder: folder,
+		SaveFeeds:  true,
+		Notifiers: map[string]NotifierConfig{
+			"file": {Type: NotifierTypeFile, Path: items},
+		},
+		Feeds: []Feed{
+			{Url: server.URL + "/a", Filters: []Filter{{Expression: "First"}}},
+			{Url: server.URL + "/b", Filters: []Filter{{Expression: "First"}}, Paused: true},
+		},
+	}
+
+	for run := 0; run < 2; run++ {
+		err = once(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The feed is not due in the second run so nothing new is sent.
+		data, err := ioutil.ReadFile(items)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Count(string(data), "First item") != 1 {
+			t.Errorf("run %d: expected the item to be delivered once but got %s", run, data)
+		}
+	}
+
+	feed := Feed{Url: server.URL + "/a"}
+	if _, err := os.Stat(feed.Filename(folder) + ".msgpack"); err != nil {
+		t.Error("feed was not saved: ", err)
+	}
+
+	paused := Feed{Url: server.URL + "/b"}
+	if _, err := os.Stat(paused.Filename(folder) + ".msgpack"); !os.IsNotExist(err) {
+		t.Error("paused feed was fetched")
+	}
+
+	broken := *conf
+	broken.Feeds = []Feed{{Url: server.URL + "/broken", Filters: []Filter{{Expression: "First"}}}}
+	server.Config.Handler = http.NotFoundHandler()
+
+	err = once(&broken)
+	if err == nil || !strings.Contains(err.Error(), "/broken") {
+		t.Error("expected an error for the broken feed but got ", err)
+	}
+}
+
+func TestOnceDeadLetter(t *testing.T) {
+	defer rss.CacheParsedItemIDs(rss.CacheParsedItemIDs(false))
+
+	feeds := testFeedServer()
+	defer feeds.Close()
+
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rejected", http.StatusBadRequest)
+	}))
+	defer hook.Close()
+
+	folder, err := ioutil.TempDir("", "rsswatch-once")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	conf := &Config{
+		Catchup:    Catchup{Mode: CatchupAll},
+		DataFolder: folder,
+		Notifiers: map[string]NotifierConfig{
+			"hook": {Type: NotifierTypeWebhook, Url: hook.URL},
+		},
+		Feeds: []Feed{{Url: feeds.URL + "/a", Filters: []Filter{{Expression: "First"}}}},
+	}
+
+	// A rejected notification must not count as delivered.
+	err = once(conf)
+	if err == nil || !strings.Contains(err.Error(), "dead folder") {
+		t.Error("expected an error for the dead message but got ", err)
+	}
+}
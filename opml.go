@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+
+	"github.com/juju/errgo"
+)
+
+// DefaultImportFilter is used for feeds imported from other feed readers as
+// they usually show every item.
+const DefaultImportFilter = ".*"
+
+type opmlDocument struct {
+	XMLName  xml.Name      `xml:"opml"`
+	Version  string        `xml:"version,attr"`
+	Title    string        `xml:"head>title"`
+	Outlines []opmlOutline `xml:"body>outline"`
+}
+
+// opmlOutline is a folder or a feed. The settings of a feed that have no
+// place in opml are kept as json in the rsswatchFeed attribute.
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XmlUrl   string        `xml:"xmlUrl,attr,omitempty"`
+	Settings string        `xml:"rsswatchFeed,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// exportOPML writes the feeds as opml. The folders of the feeds are split at
+// the dots into nested outlines.
+func exportOPML(feeds []Feed) ([]byte, error) {
+	root := new(opmlOutline)
+
+	for _, feed := range feeds {
+		settings := feed
+		settings.Url = ""
+		settings.Folder = ""
+
+		data, err := json.Marshal(settings)
+		if err != nil {
+			return nil, err
+		}
+
+		parent := root
+		if feed.Folder != "" {
+			for _, folder := range strings.Split(feed.Folder, ".") {
+				parent = parent.folder(folder)
+			}
+		}
+
+		parent.Outlines = append(parent.Outlines, opmlOutline{
+			Text:     feed.Url,
+			Type:     "rss",
+			XmlUrl:   feed.Url,
+			Settings: string(data),
+		})
+	}
+
+	document := opmlDocument{
+		Version:  "2.0",
+		Title:    name + " feeds",
+		Outlines: root.Outlines,
+	}
+
+	data, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// folder returns the child folder with the given name and creates it if it
+// does not exist.
+func (outline *opmlOutline) folder(folderName string) *opmlOutline {
+	for i := range outline.Outlines {
+		child := &outline.Outlines[i]
+		if child.XmlUrl == "" && child.Text == folderName {
+			return child
+		}
+	}
+
+	outline.Outlines = append(outline.Outlines, opmlOutline{Text: folderName})
+	return &outline.Outlines[len(outline.Outlines)-1]
+}
+
+// importOPML reads the feeds from opml. The names of the outlines a feed is
+// nested in are joined with dots to the folder of the feed.
+func importOPML(data []byte) ([]Feed, error) {
+	var document opmlDocument
+	err := xml.Unmarshal(data, &document)
+	if err != nil {
+		return nil, err
+	}
+
+	return importOutlines(document.Outlines, nil)
+}
+
+func importOutlines(outlines []opmlOutline, folders []string) ([]Feed, error) {
+	var feeds []Feed
+	for _, outline := range outlines {
+		if outline.XmlUrl == "" {
+			folderName := outline.Text
+			if folderName == "" {
+				folderName = outline.Title
+			}
+
+			nested, err := importOutlines(outline.Outlines, append(folders, folderName))
+			if err != nil {
+				return nil, err
+			}
+
+			feeds = append(feeds, nested...)
+			continue
+		}
+
+		// Feeds exported by us keep their settings even without filters, for
+		// example if they only use the global filters.
+		feed := Feed{Filters: []Filter{{Expression: DefaultImportFilter}}}
+		if outline.Settings != "" {
+			feed = Feed{}
+			err := json.Unmarshal([]byte(outline.Settings), &feed)
+			if err != nil {
+				return nil, errgo.Notef(err, "settings of %s", outline.XmlUrl)
+			}
+		}
+
+		feed.Url = outline.XmlUrl
+		feed.Folder = strings.Join(folders, ".")
+
+		feeds = append(feeds, feed)
+	}
+
+	return feeds, nil
+}
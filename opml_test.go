@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOPMLRoundTrip(t *testing.T) {
+	feeds := []Feed{
+		{Url: "http://localhost/a", Filters: []Filter{{Expression: "First"}}},
+		{Url: "http://localhost/b", Folder: "news.tech", Notifiers: []string{"file"},
+			Filters: []Filter{{Expression: "/Go/ and not /Rust/", Field: FilterFieldAny}}},
+		{Url: "http://localhost/c", Folder: "news", Paused: true,
+			Filters: []Filter{{Expression: "Release"}}, Catchup: &Catchup{Mode: CatchupNone}},
+		{Url: "http://localhost/d", Folder: "news.tech", Filters: []Filter{{Expression: "Second"}}},
+		{Url: "http://localhost/e", Folder: "news", Notifiers: []string{"file"}},
+	}
+
+	data, err := exportOPML(feeds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	imported, err := importOPML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The feeds are grouped by folder in the opml file.
+	expected := []Feed{feeds[0], feeds[1], feeds[3], feeds[2], feeds[4]}
+	if !reflect.DeepEqual(imported, expected) {
+		t.Errorf("round trip changed the feeds:\n%+v\n%s", imported, data)
+	}
+}
+
+func TestOPMLImport(t *testing.T) {
+	data := []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<opml version="1.0">
+<head><title>Reader subscriptions</title></head>
+<body>
+  <outline text="Blogs" title="Blogs">
+    <outline text="Example" title="Example" type="rss" xmlUrl="http://localhost/feed" htmlUrl="http://localhost/"/>
+    <outline title="Music">
+      <outline text="Songs" type="rss" xmlUrl="http://localhost/songs"/>
+    </outline>
+  </outline>
+  <outline text="Top" type="rss" xmlUrl="http://localhost/top"/>
+</body>
+</opml>`)
+
+	feeds, err := importOPML(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Feed{
+		{Url: "http://localhost/feed", Folder: "Blogs", Filters: []Filter{{Expression: DefaultImportFilter}}},
+		{Url: "http://localhost/songs", Folder: "Blogs.Music", Filters: []Filter{{Expression: DefaultImportFilter}}},
+		{Url: "http://localhost/top", Filters: []Filter{{Expression: DefaultImportFilter}}},
+	}
+	if !reflect.DeepEqual(feeds, expected) {
+		t.Errorf("wrong feeds: %+v", feeds)
+	}
+}
@@ -0,0 +1,445 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlexanderThaller/logger"
+	"github.com/juju/errgo"
+	"github.com/vmihailenco/msgpack"
+)
+
+const (
+	DefaultQueueMaxAttempts = 10
+	DefaultQueueBackoffMin  = 2 * time.Second
+	DefaultQueueBackoffMax  = 1 * time.Hour
+	DefaultQueueIdle        = 1 * time.Minute
+	DefaultQueueDrain       = 1 * time.Minute
+
+	queueFolder        = "queue"
+	queuePendingFolder = "pending"
+	queueDeadFolder    = "dead"
+	queueExtension     = ".msgpack"
+	queueTempExtension = ".tmp"
+)
+
+// Queue is a disk backed queue for outbound messages. Every message is saved
+// in its own file under the DataFolder before it is delivered so no message
+// gets lost when the program crashes or is restarted. Failed deliveries are
+// retried with an exponential backoff until MaxAttempts is reached, after
+// that the message is moved to the dead folder of the queue.
+type Queue struct {
+	Name        string
+	Folder      string
+	MaxAttempts int
+	BackoffMin  time.Duration
+	BackoffMax  time.Duration
+
+	deliver  func([]byte) error
+	wakeup   chan struct{}
+	stop     chan struct{}
+	stopped  chan struct{}
+	running  bool
+	sequence uint64
+	dead     int
+	lock     sync.Mutex
+	stopOnce sync.Once
+}
+
+// queueError can be returned by the deliver function of a queue to change
+// how the message is retried. Permanent errors move the message to the dead
+// folder right away and RetryAfter overwrites the backoff if it is longer.
+type queueError struct {
+	error
+	Permanent  bool
+	RetryAfter time.Duration
+}
+
+type queueEntry struct {
+	Attempts  int
+	Created   time.Time
+	Next      time.Time
+	LastError string
+	Payload   []byte
+}
+
+func NewQueue(conf *Config, queueName string, deliver func([]byte) error) (*Queue, error) {
+	queue := new(Queue)
+	queue.Name = queueName
+	queue.Folder = filepath.Join(conf.DataFolder, queueFolder, queueFolderName(queueName))
+	queue.MaxAttempts = conf.QueueMaxAttempts
+	queue.deliver = deliver
+	queue.wakeup = make(chan struct{}, 1)
+	queue.stop = make(chan struct{})
+	queue.stopped = make(chan struct{})
+
+	if queue.MaxAttempts <= 0 {
+		queue.MaxAttempts = DefaultQueueMaxAttempts
+	}
+
+	var err error
+	queue.BackoffMin, err = parseDurationDefault(conf.QueueBackoffMin, DefaultQueueBackoffMin)
+	if err != nil {
+		return nil, err
+	}
+
+	queue.BackoffMax, err = parseDurationDefault(conf.QueueBackoffMax, DefaultQueueBackoffMax)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, folder := range []string{queuePendingFolder, queueDeadFolder} {
+		err = os.MkdirAll(filepath.Join(queue.Folder, folder), 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return queue, nil
+}
+
+func launchQueue(conf *Config, queueName string, deliver func([]byte) error) (*Queue, error) {
+	queue, err := NewQueue(conf, queueName, deliver)
+	if err != nil {
+		return nil, err
+	}
+
+	queue.running = true
+	go queue.Run()
+
+	return queue, nil
+}
+
+// Push will save the payload to the queue and wake up the delivery.
+func (queue *Queue) Push(payload []byte) error {
+	queue.lock.Lock()
+	queue.sequence++
+	filename := fmt.Sprintf("%020d-%06d", time.Now().UnixNano(), queue.sequence%1000000)
+	queue.lock.Unlock()
+
+	now := time.Now()
+	entry := &queueEntry{
+		Created: now,
+		Next:    now,
+		Payload: payload,
+	}
+
+	err := queue.write(queue.path(queuePendingFolder, filename+queueExtension), entry)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case queue.wakeup <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// Run will deliver all pending messages of the queue. Messages that were
+// left over from a previous run are replayed first.
+func (queue *Queue) Run() {
+	l := logger.New(name, "Queue", "Run", queue.Name)
+	defer close(queue.stopped)
+
+	for {
+		next, err := queue.Process()
+		if err != nil {
+			l.Error("Problem while processing queue: ", err)
+		}
+
+		wait := DefaultQueueIdle
+		if !next.IsZero() && next.Sub(time.Now()) < wait {
+			wait = next.Sub(time.Now())
+		}
+
+		l.Trace("Waiting for ", wait)
+		select {
+		case <-queue.stop:
+			l.Debug("Stopped")
+			return
+		case <-queue.wakeup:
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Stop will stop the delivery of the queue and wait until the current
+// delivery run is finished. Pending messages stay on disk. Stopping a
+// queue more than once does nothing.
+func (queue *Queue) Stop() {
+	queue.stopOnce.Do(func() { close(queue.stop) })
+
+	if queue.running {
+		<-queue.stopped
+	}
+}
+
+// Drain will wait until all pending messages are delivered or moved to the
+// dead folder. It gives up after DefaultQueueDrain and returns an error, the
+// messages that are still pending stay on disk. Messages this queue moved to
+// the dead folder are reported as an error too.
+func (queue *Queue) Drain() error {
+	deadline := time.Now().Add(DefaultQueueDrain)
+	for {
+		pending, err := queue.Pending()
+		if err != nil {
+			return err
+		}
+
+		if len(pending) == 0 {
+			queue.lock.Lock()
+			dead := queue.dead
+			queue.lock.Unlock()
+
+			if dead != 0 {
+				return errgo.Newf("%d messages of queue %s were moved to the dead folder",
+					dead, queue.Name)
+			}
+
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return errgo.Newf("%d messages of queue %s are still pending",
+				len(pending), queue.Name)
+		}
+
+		select {
+		case queue.wakeup <- struct{}{}:
+		default:
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Process will try to deliver every pending message that is due and returns
+// the time the next message will be due.
+func (queue *Queue) Process() (time.Time, error) {
+	l := logger.New(name, "Queue", "Process", queue.Name)
+
+	filenames, err := queue.Pending()
+	if err != nil {
+		return time.Time{}, err
+	}
+	l.Trace("Pending: ", len(filenames))
+
+	var next time.Time
+	for _, filename := range filenames {
+		path := queue.path(queuePendingFolder, filename)
+
+		entry, err := queue.read(path)
+		if err != nil {
+			l.Error("Can not read message ", filename, ". Moving it to ",
+				queue.path(queueDeadFolder, filename), ": ", err)
+
+			err = os.Rename(path, queue.path(queueDeadFolder, filename))
+			if err != nil {
+				l.Error("Can not move message ", filename, " to the dead folder: ", err)
+				continue
+			}
+
+			queue.countDead()
+			continue
+		}
+
+		if entry.Next.After(time.Now()) {
+			if next.IsZero() || entry.Next.Before(next) {
+				next = entry.Next
+			}
+
+			continue
+		}
+
+		l.Debug("Delivering message ", filename)
+		err = queue.deliver(entry.Payload)
+		if err == nil {
+			l.Debug("Delivered message ", filename)
+			err = os.Remove(path)
+			if err != nil {
+				l.Error("Can not remove delivered message ", filename, ": ", err)
+			}
+
+			continue
+		}
+
+		entry.Attempts++
+		entry.LastError = err.Error()
+		l.Warning("Can not deliver message ", filename, " (attempt ",
+			entry.Attempts, "): ", err)
+
+		delay := queue.backoff(entry.Attempts)
+		permanent := false
+		if failure, ok := err.(*queueError); ok {
+			permanent = failure.Permanent
+			if failure.RetryAfter > delay {
+				delay = failure.RetryAfter
+				if delay > queue.BackoffMax {
+					delay = queue.BackoffMax
+				}
+			}
+		}
+
+		if entry.Attempts >= queue.MaxAttempts || permanent {
+			l.Error("Giving up on message ", filename, " after ", entry.Attempts,
+				" attempts. Moving it to ", queue.path(queueDeadFolder, filename))
+
+			err = queue.write(queue.path(queueDeadFolder, filename), entry)
+			if err == nil {
+				err = os.Remove(path)
+			}
+			if err != nil {
+				l.Error("Can not move message ", filename, " to the dead folder: ", err)
+				continue
+			}
+
+			queue.countDead()
+			continue
+		}
+
+		entry.Next = time.Now().Add(delay)
+		if next.IsZero() || entry.Next.Before(next) {
+			next = entry.Next
+		}
+
+		err = queue.write(path, entry)
+		if err != nil {
+			l.Error("Can not update message ", filename, ": ", err)
+		}
+	}
+
+	return next, nil
+}
+
+// countDead counts a message that was moved to the dead folder so Drain can
+// report it.
+func (queue *Queue) countDead() {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+
+	queue.dead++
+}
+
+// Pending returns the sorted filenames of all pending messages.
+func (queue *Queue) Pending() ([]string, error) {
+	return queue.list(queuePendingFolder)
+}
+
+// Dead returns the sorted filenames of all messages we gave up on.
+func (queue *Queue) Dead() ([]string, error) {
+	return queue.list(queueDeadFolder)
+}
+
+func (queue *Queue) list(folder string) ([]string, error) {
+	infos, err := ioutil.ReadDir(queue.path(folder))
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	for _, info := range infos {
+		if info.IsDir() || !strings.HasSuffix(info.Name(), queueExtension) {
+			continue
+		}
+
+		out = append(out, info.Name())
+	}
+	sort.Strings(out)
+
+	return out, nil
+}
+
+func (queue *Queue) backoff(attempts int) time.Duration {
+	return exponentialBackoff(queue.BackoffMin, queue.BackoffMax, attempts)
+}
+
+func (queue *Queue) path(elements ...string) string {
+	return filepath.Join(append([]string{queue.Folder}, elements...)...)
+}
+
+func (queue *Queue) read(path string) (*queueEntry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := new(queueEntry)
+	err = msgpack.Unmarshal(data, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+// write will save the entry to a temporary file first and then rename it so
+// we never end up with a half written message.
+func (queue *Queue) write(path string, entry *queueEntry) error {
+	data, err := msgpack.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	temp := path + queueTempExtension
+	file, err := os.Create(temp)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(temp)
+		return err
+	}
+
+	return os.Rename(temp, path)
+}
+
+// queueFolderName returns the name of the folder of the queue. The names of
+// the queues come from the config so they can not contain path separators
+// or point to the parent folder.
+func queueFolderName(queueName string) string {
+	folder := strings.NewReplacer("/", "_", "\\", "_").Replace(queueName)
+	if folder == "" || folder == "." || folder == ".." {
+		return "_" + folder
+	}
+
+	return folder
+}
+
+// exponentialBackoff doubles min for every attempt after the first one
+// until it reaches max.
+func exponentialBackoff(min, max time.Duration, attempts int) time.Duration {
+	backoff := min
+	for i := 1; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+
+	if backoff > max {
+		backoff = max
+	}
+
+	return backoff
+}
+
+func parseDurationDefault(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	return time.ParseDuration(value)
+}
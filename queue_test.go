@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testQueue(t *testing.T, deliver func([]byte) error) (*Queue, *Config, func()) {
+	folder, err := ioutil.TempDir("", "rsswatch-queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conf := &Config{
+		DataFolder:       folder,
+		QueueBackoffMin:  "1ms",
+		QueueBackoffMax:  "1ms",
+		QueueMaxAttempts: 3,
+	}
+
+	queue, err := NewQueue(conf, "test", deliver)
+	if err != nil {
+		os.RemoveAll(folder)
+		t.Fatal(err)
+	}
+
+	return queue, conf, func() { os.RemoveAll(folder) }
+}
+
+func TestQueueReplay(t *testing.T) {
+	var delivered []string
+	deliver := func(payload []byte) error {
+		delivered = append(delivered, string(payload))
+		return nil
+	}
+
+	queue, conf, cleanup := testQueue(t, deliver)
+	defer cleanup()
+
+	for _, payload := range []string{"first", "second"} {
+		err := queue.Push([]byte(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A new queue on the same folder has to pick up the pending messages.
+	replay, err := NewQueue(conf, "test", deliver)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = replay.Process()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(delivered) != 2 || delivered[0] != "first" || delivered[1] != "second" {
+		t.Error("got wrong deliveries: ", delivered)
+	}
+
+	pending, _ := replay.Pending()
+	if len(pending) != 0 {
+		t.Error("expected no pending messages but got ", pending)
+	}
+}
+
+func TestQueueDeadLetter(t *testing.T) {
+	var delivered []string
+	queue, _, cleanup := testQueue(t, func(payload []byte) error {
+		if string(payload) == "poison" {
+			return errors.New("can not deliver")
+		}
+
+		delivered = append(delivered, string(payload))
+		return nil
+	})
+	defer cleanup()
+
+	for _, payload := range []string{"poison", "good"} {
+		err := queue.Push([]byte(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < queue.MaxAttempts; i++ {
+		time.Sleep(2 * time.Millisecond)
+		_, err := queue.Process()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(delivered) != 1 || delivered[0] != "good" {
+		t.Error("poison message blocked the queue: ", delivered)
+	}
+
+	pending, _ := queue.Pending()
+	dead, _ := queue.Dead()
+	if len(pending) != 0 || len(dead) != 1 {
+		t.Error("expected the poison message in the dead folder, pending: ",
+			pending, " dead: ", dead)
+	}
+
+	if queue.Drain() == nil {
+		t.Error("expected drain to report the dead message")
+	}
+}
+
+func TestQueueUnreadable(t *testing.T) {
+	queue, _, cleanup := testQueue(t, func([]byte) error { return nil })
+	defer cleanup()
+
+	err := ioutil.WriteFile(queue.path(queuePendingFolder, "broken"+queueExtension),
+		[]byte("not msgpack"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = queue.Process()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, _ := queue.Pending()
+	dead, _ := queue.Dead()
+	if len(pending) != 0 || len(dead) != 1 {
+		t.Error("expected the unreadable message in the dead folder, pending: ",
+			pending, " dead: ", dead)
+	}
+
+	if queue.Drain() == nil {
+		t.Error("expected drain to report the unreadable message")
+	}
+}
+
+func TestQueueFolderName(t *testing.T) {
+	_, conf, cleanup := testQueue(t, nil)
+	defer cleanup()
+
+	for _, queueName := range []string{"..", "../escape", "a/b", ""} {
+		queue, err := NewQueue(conf, queueName, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parent := filepath.Join(conf.DataFolder, queueFolder)
+		if filepath.Dir(queue.Folder) != parent {
+			t.Errorf("queue %q uses folder %s outside of %s", queueName, queue.Folder, parent)
+		}
+	}
+}
+
+func TestQueueStopTwice(t *testing.T) {
+	_, conf, cleanup := testQueue(t, nil)
+	defer cleanup()
+
+	queue, err := launchQueue(conf, "stop", func([]byte) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queue.Stop()
+	queue.Stop()
+}
@@ -23,15 +23,34 @@ var (
 	buildTime    string
 
 	flagConfigPath = flag.String("config", name+".cnf",
-		"The path to the config file.")
+		"The path to the config file. Files ending in .toml, .yaml or .yml are "+
+			"read as toml or yaml, all others as json.")
 	flagProfiling = flag.String("profile", "localhost:6060", "Enable profiling.")
+	flagOnce      = flag.Bool("once", false,
+		"Fetch every feed that is due once, deliver the notifications and exit.")
 
 	configuration *Config
 )
 
-func init() {
+func main() {
 	flag.Parse()
-	l := logger.New(name, "init")
+	l := logger.New(name, "main")
+
+	if flag.NArg() != 0 {
+		command, exists := commands[flag.Arg(0)]
+		if !exists {
+			l.Alert("Unknown command ", flag.Arg(0))
+			os.Exit(1)
+		}
+
+		err := command(flag.Args()[1:])
+		if err != nil {
+			l.Alert("Problem while running ", flag.Arg(0), ": ", errgo.Details(err))
+			os.Exit(1)
+		}
+
+		return
+	}
 
 	// Load configuration
 	var err error
@@ -48,15 +67,22 @@ func init() {
 		os.Exit(1)
 	}
 
+	if *flagOnce {
+		err = once(configuration)
+		if err != nil {
+			l.Alert("Problem while running once: ", errgo.Details(err))
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	// Start profiling
 	if *flagProfiling != "" {
 		l.Info("Starting profiling on ", *flagProfiling)
 		go func() { l.Notice(http.ListenAndServe(*flagProfiling, nil)) }()
 	}
-}
 
-func main() {
-	l := logger.New(name, "main")
 	l.Notice("Starting")
 	l.Info("Version: ", buildVersion)
 	l.Info("Buildtime: ", buildTime)
@@ -67,7 +93,7 @@ func main() {
 	watch()
 
 	// Launch
-	err := launch(configuration)
+	err = launch(*flagConfigPath, configuration)
 	if err != nil {
 		l.Alert("Problem while launching: ", errgo.Details(err))
 		os.Exit(1)
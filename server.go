@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"html"
+	"mime"
+	"net"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexanderThaller/logger"
+	"github.com/AlexanderThaller/service"
+	"github.com/juju/errgo"
+)
+
+var (
+	errFeedNotFound = errgo.New("feed not found")
+	errFeedExists   = errgo.New("feed already exists")
+)
+
+// ServerTokenHeader is the header that has to hold the api token for every
+// request that changes the feeds.
+const ServerTokenHeader = "X-RssWatch-Token"
+
+// feedInfo is a configured feed as it is shown by the http api.
+type feedInfo struct {
+	Feed
+	Running bool
+	Status  FeedStatus
+	Matches []itemEntry
+}
+
+// Server is the service that serves the http api and the web interface that
+// are used to manage the feeds of the watcher. All changes are applied to
+// the running feeds and saved to the config file.
+//
+// Requests that change the feeds need a json content type and the api token
+// in the ServerTokenHeader so other websites can not change the feeds from
+// the browser. Without HttpToken in the config a random token is generated
+// that the web interface gets with the index page. With HttpToken the index
+// page asks for the token as the password of basic auth.
+type Server struct {
+	Listen    string
+	generated string
+	watcher   *Watcher
+	server    *http.Server
+}
+
+// NewServer returns a server for the watcher.
+func NewServer(listen string, watcher *Watcher) (*Server, error) {
+	server := new(Server)
+	server.Listen = listen
+	server.watcher = watcher
+
+	random := make([]byte, 16)
+	_, err := rand.Read(random)
+	if err != nil {
+		return nil, errgo.Notef(err, "can not generate api token")
+	}
+	server.generated = hex.EncodeToString(random)
+
+	return server, nil
+}
+
+func (server *Server) Start(messages chan<- service.Message) error {
+	l := logger.New(name, "Server", "Start")
+
+	listener, err := net.Listen("tcp", server.Listen)
+	if err != nil {
+		return err
+	}
+
+	l.Info("Listening on ", listener.Addr())
+	server.server = &http.Server{Handler: server.Handler()}
+	go func() {
+		err := server.server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			l.Error("Can not serve: ", err)
+		}
+	}()
+
+	return nil
+}
+
+func (server *Server) Stop() {
+	server.server.Close()
+}
+
+// Reload does nothing as the listen address can only be changed with a
+// restart. The api token is read from the config of the watcher for every
+// request so a changed HttpToken is applied with the reload of the watcher.
+func (server *Server) Reload() {
+}
+
+// Handler returns the handler that serves the web interface and the api.
+func (server *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", server.handleIndex)
+	mux.HandleFunc("/api/feeds", server.protect(server.handleFeeds))
+	mux.HandleFunc("/api/feed", server.protect(server.handleFeed))
+	mux.HandleFunc("/api/feed/pause", server.protect(server.handlePause(true)))
+	mux.HandleFunc("/api/feed/resume", server.protect(server.handlePause(false)))
+	mux.HandleFunc("/api/matches", server.handleMatches)
+	mux.HandleFunc("/feeds/", server.handleSyndication)
+
+	return mux
+}
+
+func (server *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	token, configured := server.token()
+	if configured {
+		_, password, _ := r.BasicAuth()
+		if subtle.ConstantTimeCompare([]byte(password), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+name+`"`)
+			http.Error(w, "invalid api token", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(strings.Replace(serverIndex, "{{token}}", html.EscapeString(token), 1)))
+}
+
+// token returns the api token and true if it is the HttpToken of the config.
+// Without HttpToken the generated token is returned.
+func (server *Server) token() (string, bool) {
+	token := server.watcher.HttpToken()
+	if token == "" {
+		return server.generated, false
+	}
+
+	return token, true
+}
+
+// protect returns a handler that only passes requests that change the feeds
+// if they have a json content type and the api token. Browsers do not send
+// either for forms of other websites without asking the server first.
+func (server *Server) protect(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" || r.Method == "HEAD" {
+			handler(w, r)
+			return
+		}
+
+		kind, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || kind != "application/json" {
+			http.Error(w, "content type has to be application/json",
+				http.StatusUnsupportedMediaType)
+			return
+		}
+
+		token, _ := server.token()
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(ServerTokenHeader)), []byte(token)) != 1 {
+			http.Error(w, "invalid api token", http.StatusForbidden)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// handleFeeds lists all feeds or adds a new one.
+func (server *Server) handleFeeds(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		writeJSON(w, http.StatusOK, server.watcher.Feeds())
+
+	case "POST":
+		var settings Feed
+		err := json.NewDecoder(r.Body).Decode(&settings)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if settings.Url == "" {
+			http.Error(w, "feed needs an url", http.StatusBadRequest)
+			return
+		}
+
+		err = server.watcher.Change(func(conf *Config) error {
+			if findFeed(conf, settings.Url) != -1 {
+				return errFeedExists
+			}
+
+			conf.Feeds = append(conf.Feeds, settings)
+			return nil
+		})
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, settings)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleFeed shows, replaces or deletes the feed with the url given in the
+// url query parameter.
+func (server *Server) handleFeed(w http.ResponseWriter, r *http.Request) {
+	url := r.URL.Query().Get("url")
+
+	switch r.Method {
+	case "GET":
+		for _, info := range server.watcher.Feeds() {
+			if info.Url == url {
+				writeJSON(w, http.StatusOK, info)
+				return
+			}
+		}
+
+		writeError(w, errFeedNotFound)
+
+	case "PUT":
+		var settings Feed
+		err := json.NewDecoder(r.Body).Decode(&settings)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if settings.Url == "" {
+			settings.Url = url
+		}
+
+		err = server.watcher.Change(func(conf *Config) error {
+			index := findFeed(conf, url)
+			if index == -1 {
+				return errFeedNotFound
+			}
+
+			if settings.Url != url && findFeed(conf, settings.Url) != -1 {
+				return errFeedExists
+			}
+
+			conf.Feeds[index] = settings
+			return nil
+		})
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, settings)
+
+	case "DELETE":
+		err := server.watcher.Change(func(conf *Config) error {
+			index := findFeed(conf, url)
+			if index == -1 {
+				return errFeedNotFound
+			}
+
+			conf.Feeds = append(conf.Feeds[:index], conf.Feeds[index+1:]...)
+			return nil
+		})
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handlePause returns a handler that pauses or resumes the feed with the url
+// given in the url query parameter.
+func (server *Server) handlePause(paused bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		url := r.URL.Query().Get("url")
+		err := server.watcher.Change(func(conf *Config) error {
+			index := findFeed(conf, url)
+			if index == -1 {
+				return errFeedNotFound
+			}
+
+			conf.Feeds[index].Paused = paused
+			return nil
+		})
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleMatches lists the recent matches of all feeds, the newest first.
+func (server *Server) handleMatches(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	matches := []itemEntry{}
+	for _, info := range server.watcher.Feeds() {
+		matches = append(matches, info.Matches...)
+	}
+	sort.Stable(entriesByDate(matches))
+
+	writeJSON(w, http.StatusOK, matches)
+}
+
+// handleSyndication serves the recent matches of a feed, a folder or a
+// filter as an atom, rss or json feed. The path selects what is served and
+// the format, for example /feeds/feed.atom?url=..., /feeds/folder.rss?name=...
+// or /feeds/filter.json?name=...
+func (server *Server) handleSyndication(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	base := path.Base(r.URL.Path)
+	format := strings.TrimPrefix(path.Ext(base), ".")
+	selected := r.URL.Query().Get("name")
+
+	var feed syndication
+	var match func(entry historyEntry) bool
+	kind := strings.TrimSuffix(base, path.Ext(base))
+	switch kind {
+	case "feed":
+		selected = r.URL.Query().Get("url")
+		configured := false
+		for _, info := range server.watcher.Feeds() {
+			configured = configured || info.Url == selected
+		}
+
+		if !configured {
+			writeError(w, errFeedNotFound)
+			return
+		}
+
+		feed.Title = name + ": " + selected
+		match = func(entry historyEntry) bool {
+			return entry.FeedUrl == selected
+		}
+
+	case "folder":
+		feed.Title = name + ": " + selected
+		match = func(entry historyEntry) bool {
+			return entry.Folder == selected
+		}
+
+	case "filter":
+		feed.Title = name + ": " + selected
+		match = func(entry historyEntry) bool {
+			for _, filterName := range entry.Filters {
+				if filterName == selected {
+					return true
+				}
+			}
+
+			return entry.Filter == selected
+		}
+
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	feed.ID = syndicationID(kind, selected)
+	feed.Link = scheme + "://" + r.Host + r.URL.RequestURI()
+	feed.Entries = server.watcher.History(match)
+	if len(feed.Entries) != 0 && feed.Entries[0].FeedUrl == selected {
+		feed.Title = name + ": " + feed.Entries[0].Feed
+	}
+
+	data, contentType, err := feed.Encode(format)
+	if err == errUnknownSyndication {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	hash := sha256.Sum256(data)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age="+
+		strconv.Itoa(int(DefaultSyndicationMaxAge/time.Second)))
+	w.Header().Set("ETag", `"`+hex.EncodeToString(hash[:16])+`"`)
+
+	// ServeContent answers conditional requests with the etag and the time
+	// of the newest match.
+	http.ServeContent(w, r, "", feed.Updated(), bytes.NewReader(data))
+}
+
+func writeJSON(w http.ResponseWriter, code int, value interface{}) {
+	l := logger.New(name, "Server", "writeJSON")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		l.Warning("Can not write response: ", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch errgo.Cause(err) {
+	case errFeedNotFound:
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errFeedExists:
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// entriesByDate sorts item entries from the newest to the oldest.
+type entriesByDate []itemEntry
+
+func (entries entriesByDate) Len() int      { return len(entries) }
+func (entries entriesByDate) Swap(i, j int) { entries[i], entries[j] = entries[j], entries[i] }
+func (entries entriesByDate) Less(i, j int) bool {
+	return entries[i].Date.After(entries[j].Date)
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	rss "github.com/AlexanderThaller/rss-1"
+)
+
+func TestServerFeeds(t *testing.T) {
+	feeds := testFeedServer()
+	defer feeds.Close()
+
+	folder, err := ioutil.TempDir("", "rsswatch-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	path := filepath.Join(folder, "config")
+	conf := &Config{
+		DataFolder: folder,
+		HttpToken:  "secret",
+		Notifiers: map[string]NotifierConfig{
+			"file": {Type: NotifierTypeFile, Path: filepath.Join(folder, "items")},
+		},
+	}
+
+	watcher := NewWatcher(path, conf)
+	err = watcher.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Stop()
+
+	server := testServer(t, watcher)
+	defer server.Close()
+
+	send := func(method, path, contentType, token string, body interface{}) int {
+		var data []byte
+		if body != nil {
+			data, _ = json.Marshal(body)
+		}
+
+		req, err := http.NewRequest(method, server.URL+path, bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set(ServerTokenHeader, token)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	request := func(method, path string, body interface{}) int {
+		return send(method, path, "application/json", "secret", body)
+	}
+
+	feedUrl := feeds.URL + "/a"
+	query := "?url=" + url.QueryEscape(feedUrl)
+
+	added := Feed{Url: feedUrl, Filters: []Filter{{Expression: "First"}}}
+	if code := send("POST", "/api/feeds", "application/json", "", added); code != http.StatusForbidden {
+		t.Fatal("expected a request without token to be forbidden but got ", code)
+	}
+
+	if code := send("POST", "/api/feeds", "text/plain", "secret", added); code != http.StatusUnsupportedMediaType {
+		t.Fatal("expected a request without json to be rejected but got ", code)
+	}
+
+	if code := request("POST", "/api/feeds", added); code != http.StatusCreated {
+		t.Fatal("expected the feed to be created but got ", code)
+	}
+
+	if code := request("POST", "/api/feeds", added); code != http.StatusConflict {
+		t.Error("expected a conflict for a duplicate feed but got ", code)
+	}
+
+	if _, running := watcher.feeds[feedUrl]; !running {
+		t.Error("added feed is not running")
+	}
+
+	saved, err := reconfigure(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(saved.Feeds) != 1 || saved.Feeds[0].Url != feedUrl {
+		t.Error("added feed was not saved: ", saved.Feeds)
+	}
+
+	if code := request("POST", "/api/feed/pause"+query, nil); code != http.StatusNoContent {
+		t.Error("expected the feed to be paused but got ", code)
+	}
+
+	if _, running := watcher.feeds[feedUrl]; running {
+		t.Error("paused feed is still running")
+	}
+
+	invalid := Feed{Url: feedUrl, Filters: []Filter{{Expression: "("}}}
+	if code := request("PUT", "/api/feed"+query, invalid); code != http.StatusBadRequest {
+		t.Error("expected an invalid filter to be rejected but got ", code)
+	}
+
+	edited := Feed{Url: feedUrl, Filters: []Filter{{Expression: "Second"}}, Folder: "edited"}
+	if code := request("PUT", "/api/feed"+query, edited); code != http.StatusOK {
+		t.Error("expected the feed to be edited but got ", code)
+	}
+
+	infos := watcher.Feeds()
+	if len(infos) != 1 || infos[0].Folder != "edited" || !infos[0].Running {
+		t.Error("edited feed was not applied: ", infos)
+	}
+
+	if code := request("DELETE", "/api/feed"+query, nil); code != http.StatusNoContent {
+		t.Error("expected the feed to be deleted but got ", code)
+	}
+
+	if code := request("GET", "/api/feed"+query, nil); code != http.StatusNotFound {
+		t.Error("expected a deleted feed to be missing but got ", code)
+	}
+
+	if len(watcher.feeds) != 0 {
+		t.Error("deleted feed is still running")
+	}
+}
+
+func TestServerIndexToken(t *testing.T) {
+	watcher := NewWatcher("", new(Config))
+	server, err := NewServer("", watcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index := func(password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		if password != "" {
+			req.SetBasicAuth("", password)
+		}
+
+		recorder := httptest.NewRecorder()
+		server.Handler().ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	if len(server.generated) != 32 {
+		t.Fatal("expected a generated token but got ", server.generated)
+	}
+
+	if !strings.Contains(index("").Body.String(), `content="`+server.generated+`"`) {
+		t.Error("index does not contain the generated token")
+	}
+
+	err = watcher.Change(func(conf *Config) error {
+		conf.HttpToken = "secret"
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code := index("").Code; code != http.StatusUnauthorized {
+		t.Error("expected the index to need the configured token but got ", code)
+	}
+
+	if code := index("wrong").Code; code != http.StatusUnauthorized {
+		t.Error("expected the index to reject a wrong token but got ", code)
+	}
+
+	recorder := index("secret")
+	if recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), `content="secret"`) {
+		t.Error("index does not contain the configured token: ", recorder.Code)
+	}
+
+	if strings.Contains(recorder.Body.String(), server.generated) {
+		t.Error("index contains the generated token although a token is configured")
+	}
+}
+
+func TestServerSyndication(t *testing.T) {
+	defer rss.CacheParsedItemIDs(rss.CacheParsedItemIDs(false))
+
+	folder, err := ioutil.TempDir("", "rsswatch-server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	feedUrl := "http://localhost/feed"
+	conf := &Config{
+		DataFolder: folder,
+		Notifiers: map[string]NotifierConfig{
+			"file": {Type: NotifierTypeFile, Path: filepath.Join(folder, "items")},
+		},
+		Feeds: []Feed{{Url: feedUrl, Folder: "news", Paused: true,
+			Filters: []Filter{{Expression: "Go"}}}},
+	}
+
+	matched := time.Date(2015, 8, 19, 12, 0, 0, 0, time.UTC)
+	err = (&Feed{Url: feedUrl}).SaveHistory(folder, []historyEntry{
+		{
+			itemEntry: itemEntry{Feed: "Go Blog", Folder: "news", Filter: "Go", ID: "go-1.5",
+				Title: "Go 1.5 is released", Link: "http://localhost/go1.5"},
+			FeedUrl:    feedUrl,
+			Matched:    matched,
+			Content:    "<p>Release</p>",
+			Enclosures: []rss.Enclosure{{URL: "http://localhost/go.mp3", Type: "audio/mpeg", Length: 1}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	watcher := NewWatcher("", conf)
+	err = watcher.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Stop()
+
+	server := testServer(t, watcher)
+	defer server.Close()
+
+	get := func(path, etag string) *http.Response {
+		req, err := http.NewRequest("GET", server.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("If-None-Match", etag)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		ioutil.ReadAll(resp.Body)
+		return resp
+	}
+
+	for _, path := range []string{
+		"/feeds/feed.atom?url=" + url.QueryEscape(feedUrl),
+		"/feeds/folder.rss?name=news",
+		"/feeds/filter.json?name=Go",
+	} {
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == "" ||
+			resp.Header.Get("Cache-Control") == "" ||
+			resp.Header.Get("Last-Modified") != matched.Format(http.TimeFormat) {
+			t.Errorf("got wrong response for %s: %d %v", path, resp.StatusCode, resp.Header)
+			continue
+		}
+
+		if path != "/feeds/filter.json?name=Go" {
+			feed, err := rss.Parse(data)
+			if err != nil {
+				t.Fatal(path, ": ", err)
+			}
+
+			if len(feed.Items) != 1 || feed.Items[0].Title != "Go 1.5 is released" ||
+				len(feed.Items[0].Enclosures) != 1 {
+				t.Errorf("got wrong items for %s: %s", path, data)
+			}
+		} else {
+			var feed jsonFeedDocument
+			err = json.Unmarshal(data, &feed)
+			if err != nil || len(feed.Items) != 1 || feed.Items[0].ContentHTML != "<p>Release</p>" ||
+				len(feed.Items[0].Attachments) != 1 {
+				t.Errorf("got wrong json feed for %s: %s", path, data)
+			}
+		}
+
+		if code := get(path, resp.Header.Get("ETag")).StatusCode; code != http.StatusNotModified {
+			t.Errorf("expected %s to be not modified but got %d", path, code)
+		}
+	}
+
+	// The id of the feed does not depend on the host and empty feeds still
+	// have an updated time.
+	var ids []string
+	for _, host := range []string{"localhost", "rsswatch.example.org"} {
+		for _, path := range []string{"/feeds/folder.atom?name=news", "/feeds/folder.atom?name=empty"} {
+			req, err := http.NewRequest("GET", server.URL+path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Host = host
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			var document atomDocument
+			err = xml.Unmarshal(data, &document)
+			if err != nil {
+				t.Fatal(path, ": ", err)
+			}
+
+			updated, err := time.Parse(time.RFC3339, document.Updated)
+			if err != nil || updated.Year() < 2015 {
+				t.Errorf("got wrong updated time for %s: %s", path, document.Updated)
+			}
+
+			ids = append(ids, document.ID)
+		}
+	}
+
+	if ids[0] != ids[2] || ids[1] != ids[3] || ids[0] == ids[1] {
+		t.Error("expected stable ids for the feeds but got ", ids)
+	}
+
+	for _, path := range []string{
+		"/feeds/feed.atom?url=http://localhost/unknown",
+		"/feeds/folder.html?name=news",
+		"/feeds/unknown.atom",
+	} {
+		if code := get(path, "").StatusCode; code != http.StatusNotFound {
+			t.Errorf("expected %s to be not found but got %d", path, code)
+		}
+	}
+}
+
+func testServer(t *testing.T, watcher *Watcher) *httptest.Server {
+	server, err := NewServer("", watcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return httptest.NewServer(server.Handler())
+}
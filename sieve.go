@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"net/mail"
+	"sort"
+	"strings"
+
+	"github.com/juju/errgo"
+)
+
+// SieveRule adds actions to the sieve script for the mails of a filter.
+// Flags are set on the mail with imap4flags, Redirect forwards a copy to the
+// given address and Discard drops the mail instead of filing it.
+type SieveRule struct {
+	Flags    []string `json:",omitempty"`
+	Redirect string   `json:",omitempty"`
+	Discard  bool     `json:",omitempty"`
+}
+
+// Validate checks that the rule has an action and a valid redirect address.
+func (rule SieveRule) Validate() error {
+	if len(rule.Flags) == 0 && rule.Redirect == "" && !rule.Discard {
+		return errgo.New("sieve rule has no action")
+	}
+
+	if rule.Redirect != "" {
+		_, err := mail.ParseAddress(rule.Redirect)
+		if err != nil {
+			return errgo.Notef(err, "redirect address %s", rule.Redirect)
+		}
+	}
+
+	return nil
+}
+
+// sieveFilterRule is a sieve rule of a filter together with the folder of
+// the feed the filter belongs to. The folder is nil for global filters.
+type sieveFilterRule struct {
+	folder *string
+	filter string
+	rule   SieveRule
+}
+
+// generateSieve returns a sieve script that files the mails sent with the
+// given config into the same mailboxes the maildir notifier uses. The rules
+// of the filters are applied before the mail is filed.
+func generateSieve(conf *Config) []byte {
+	sender := conf.MailSender
+	address, err := mail.ParseAddress(sender)
+	if err == nil {
+		sender = address.Address
+	}
+
+	var rules []sieveFilterRule
+	addRules := func(folder *string, filters []Filter) {
+		for _, filter := range filters {
+			if filter.Sieve != nil {
+				rules = append(rules, sieveFilterRule{folder, strings.Replace(filter.Name(), ".", "_", -1),
+					*filter.Sieve})
+			}
+		}
+	}
+
+	folders := make(map[string]struct{})
+	for _, feed := range conf.Feeds {
+		folder := feed.Folder
+		folders[folder] = struct{}{}
+		addRules(&folder, feed.Filters)
+	}
+	addRules(nil, conf.GlobalFilters.Include)
+
+	extensions := []string{"fileinto", "variables"}
+	for _, rule := range rules {
+		if len(rule.rule.Flags) != 0 {
+			extensions = append(extensions, "imap4flags")
+			break
+		}
+	}
+
+	var script bytes.Buffer
+	script.WriteString("require [" + sieveStrings(extensions) + "];\n\n")
+
+	var names []string
+	for folder := range folders {
+		if folder != "" {
+			names = append(names, mailboxName(folder, "", ""))
+		}
+	}
+	sort.Strings(names)
+
+	script.WriteString("# " + name + " files the mails of every feed into\n")
+	script.WriteString("# " + MailboxRoot + ".<folder>.<feed>.<filter>. The configured folders are:\n")
+	for _, mailbox := range names {
+		script.WriteString("#   " + mailbox + "\n")
+	}
+	script.WriteString("if address :is \"from\" " + sieveString(sender) + " {\n")
+
+	seen := make(map[string]struct{})
+	for _, rule := range rules {
+		var block bytes.Buffer
+		condition := "header :is \"Filters\" " + sieveString(rule.filter)
+		if rule.folder != nil {
+			condition = "allof (header :is \"Folder\" " + sieveString(*rule.folder) + ", " +
+				condition + ")"
+		}
+
+		block.WriteString("  if " + condition + " {\n")
+		if len(rule.rule.Flags) != 0 {
+			block.WriteString("    addflag [" + sieveStrings(rule.rule.Flags) + "];\n")
+		}
+		if rule.rule.Redirect != "" {
+			block.WriteString("    redirect " + sieveString(rule.rule.Redirect) + ";\n")
+		}
+		if rule.rule.Discard {
+			block.WriteString("    discard;\n    stop;\n")
+		}
+		block.WriteString("  }\n\n")
+
+		if _, exists := seen[block.String()]; exists {
+			continue
+		}
+		seen[block.String()] = struct{}{}
+
+		block.WriteTo(&script)
+	}
+
+	for _, header := range []string{"Folder", "Feed", "Filter"} {
+		variable := strings.ToLower(header)
+		script.WriteString("  if header :matches " + sieveString(header) + " \"?*\" {\n")
+		script.WriteString("    set " + sieveString(variable) + " \".${0}\";\n")
+		script.WriteString("  }\n\n")
+	}
+
+	script.WriteString("  fileinto \"" + MailboxRoot + "${folder}${feed}${filter}\";\n")
+	script.WriteString("  stop;\n")
+	script.WriteString("}\n")
+
+	return script.Bytes()
+}
+
+func sieveString(value string) string {
+	value = strings.Replace(value, `\`, `\\`, -1)
+	value = strings.Replace(value, `"`, `\"`, -1)
+	return `"` + value + `"`
+}
+
+func sieveStrings(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = sieveString(value)
+	}
+
+	return strings.Join(quoted, ", ")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestGenerateSieve(t *testing.T) {
+	conf := &Config{
+		MailSender: "RssWatch <rsswatch@example.org>",
+		Feeds: []Feed{
+			{Url: "http://localhost/go", Folder: "news", Filters: []Filter{
+				{Expression: "Go", Sieve: &SieveRule{Flags: []string{`\Flagged`}}},
+				{Expression: "Rust"},
+			}},
+			{Url: "http://localhost/spam", Folder: "misc", Filters: []Filter{
+				{Expression: "go.dev", Sieve: &SieveRule{Discard: true}},
+			}},
+		},
+		GlobalFilters: GlobalFilters{Include: []Filter{
+			{Expression: "Security", Sieve: &SieveRule{Redirect: "admin@example.org"}},
+		}},
+	}
+
+	script := string(generateSieve(conf))
+	for _, expected := range []string{
+		`require ["fileinto", "variables", "imap4flags"];`,
+		`#   rss.misc`,
+		`if address :is "from" "rsswatch@example.org" {`,
+		`  if allof (header :is "Folder" "news", header :is "Filters" "Go") {
+    addflag ["\\Flagged"];
+  }`,
+		`  if allof (header :is "Folder" "misc", header :is "Filters" "go_dev") {
+    discard;
+    stop;
+  }`,
+		`  if header :is "Filters" "Security" {
+    redirect "admin@example.org";
+  }`,
+		`fileinto "rss${folder}${feed}${filter}";`,
+	} {
+		if !strings.Contains(script, expected) {
+			t.Errorf("expected script to contain\n%s\nbut got:\n%s", expected, script)
+		}
+	}
+
+	if strings.Contains(script, "Rust") {
+		t.Errorf("expected no rule for filters without sieve settings but got:\n%s", script)
+	}
+}
+
+func TestSieveRuleValidate(t *testing.T) {
+	for _, rule := range []SieveRule{{}, {Redirect: "not an address"}} {
+		feed := Feed{Filters: []Filter{{Expression: "Go", Sieve: &rule}}}
+		if feed.Validate(nil) == nil {
+			t.Errorf("expected an error for %+v", rule)
+		}
+	}
+
+	data, err := json.Marshal(Filter{Expression: "Go", Sieve: &SieveRule{Discard: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var filter Filter
+	err = json.Unmarshal(data, &filter)
+	if err != nil || filter.Sieve == nil || !filter.Sieve.Discard {
+		t.Errorf("sieve rule was lost in %s: %v", data, err)
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"net/url"
+	"time"
+
+	"github.com/juju/errgo"
+)
+
+const (
+	SyndicationAtom = "atom"
+	SyndicationRSS  = "rss"
+	SyndicationJSON = "json"
+
+	// DefaultSyndicationMaxAge is how long clients may cache the served
+	// feeds.
+	DefaultSyndicationMaxAge = 5 * time.Minute
+)
+
+var errUnknownSyndication = errgo.New("unknown feed format")
+
+// syndication is a feed of matched items that is served over http. Link is
+// the url the feed is served under and ID a stable id of the feed that does
+// not change with the host it is requested from.
+type syndication struct {
+	Title   string
+	ID      string
+	Link    string
+	Entries []historyEntry
+}
+
+// syndicationID returns an urn for the feed, folder or filter the items of a
+// feed are selected by.
+func syndicationID(kind, selected string) string {
+	hash := sha256.Sum256([]byte(kind + "\n" + selected))
+	return "urn:sha256:" + hex.EncodeToString(hash[:])
+}
+
+// Updated returns the time of the newest match in the feed.
+func (feed syndication) Updated() time.Time {
+	var updated time.Time
+	for _, entry := range feed.Entries {
+		if entry.Matched.After(updated) {
+			updated = entry.Matched
+		}
+	}
+
+	return updated
+}
+
+// Encode returns the feed in the given format together with its content
+// type.
+func (feed syndication) Encode(format string) ([]byte, string, error) {
+	switch format {
+	case SyndicationAtom:
+		data, err := feed.atom()
+		return data, "application/atom+xml; charset=utf-8", err
+
+	case SyndicationRSS:
+		data, err := feed.rss()
+		return data, "application/rss+xml; charset=utf-8", err
+
+	case SyndicationJSON:
+		data, err := feed.jsonFeed()
+		return data, "application/feed+json; charset=utf-8", err
+
+	default:
+		return nil, "", errUnknownSyndication
+	}
+}
+
+type atomDocument struct {
+	XMLName   xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Updated   string      `xml:"updated"`
+	Author    atomPerson  `xml:"author"`
+	Generator string      `xml:"generator"`
+	Links     []atomLink  `xml:"link"`
+	Entries   []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Updated    string         `xml:"updated"`
+	Author     *atomPerson    `xml:"author,omitempty"`
+	Links      []atomLink     `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+	Summary    *atomText      `xml:"summary,omitempty"`
+	Content    *atomText      `xml:"content,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+func (feed syndication) atom() ([]byte, error) {
+	// Atom requires an updated time even if nothing matched yet.
+	updated := feed.Updated()
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+
+	document := atomDocument{
+		Title:     feed.Title,
+		ID:        feed.ID,
+		Updated:   updated.UTC().Format(time.RFC3339),
+		Author:    atomPerson{Name: name},
+		Generator: name,
+		Links:     []atomLink{{Href: feed.Link, Rel: "self"}},
+	}
+
+	for _, entry := range feed.Entries {
+		item := atomEntry{
+			Title:   entry.Title,
+			ID:      entry.guid(),
+			Updated: entry.date().UTC().Format(time.RFC3339),
+		}
+
+		if entry.Author != "" {
+			item.Author = &atomPerson{Name: entry.Author}
+		}
+
+		if entry.Link != "" {
+			item.Links = append(item.Links, atomLink{Href: entry.Link, Rel: "alternate"})
+		}
+
+		for _, enclosure := range entry.Enclosures {
+			item.Links = append(item.Links, atomLink{Href: enclosure.URL, Rel: "enclosure",
+				Type: enclosure.Type, Length: enclosure.Length})
+		}
+
+		for _, category := range entry.Categories {
+			item.Categories = append(item.Categories, atomCategory{Term: category})
+		}
+
+		if entry.Summary != "" {
+			item.Summary = &atomText{Type: "html", Text: entry.Summary}
+		}
+
+		if entry.Content != "" {
+			item.Content = &atomText{Type: "html", Text: entry.Content}
+		}
+
+		document.Entries = append(document.Entries, item)
+	}
+
+	return marshalXML(document)
+}
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Generator     string    `xml:"generator"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link,omitempty"`
+	Description string        `xml:"description,omitempty"`
+	Categories  []string      `xml:"category"`
+	Enclosure   *rssEnclosure `xml:"enclosure,omitempty"`
+	GUID        rssGUID       `xml:"guid"`
+	PubDate     string        `xml:"pubDate,omitempty"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length int64  `xml:"length,attr"`
+}
+
+type rssGUID struct {
+	IsPermaLink string `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func (feed syndication) rss() ([]byte, error) {
+	channel := rssChannel{
+		Title:       feed.Title,
+		Link:        feed.Link,
+		Description: "Items matched by " + name,
+		Generator:   name,
+	}
+
+	if updated := feed.Updated(); !updated.IsZero() {
+		channel.LastBuildDate = updated.Format(time.RFC1123Z)
+	}
+
+	for _, entry := range feed.Entries {
+		item := rssItem{
+			Title:       entry.Title,
+			Link:        entry.Link,
+			Description: entry.Content,
+			Categories:  entry.Categories,
+			GUID:        rssGUID{IsPermaLink: "false", Value: entry.guid()},
+			PubDate:     entry.date().Format(time.RFC1123Z),
+		}
+
+		if item.Description == "" {
+			item.Description = entry.Summary
+		}
+
+		// RSS only allows one enclosure per item.
+		if len(entry.Enclosures) != 0 {
+			enclosure := entry.Enclosures[0]
+			item.Enclosure = &rssEnclosure{URL: enclosure.URL, Type: enclosure.Type,
+				Length: enclosure.Length}
+		}
+
+		channel.Items = append(channel.Items, item)
+	}
+
+	return marshalXML(rssDocument{Version: "2.0", Channel: channel})
+}
+
+type jsonFeedDocument struct {
+	Version string         `json:"version"`
+	Title   string         `json:"title"`
+	FeedURL string         `json:"feed_url"`
+	Items   []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url,omitempty"`
+	Title         string               `json:"title,omitempty"`
+	ContentHTML   string               `json:"content_html"`
+	Summary       string               `json:"summary,omitempty"`
+	DatePublished string               `json:"date_published,omitempty"`
+	Authors       []jsonFeedAuthor     `json:"authors,omitempty"`
+	Tags          []string             `json:"tags,omitempty"`
+	Attachments   []jsonFeedAttachment `json:"attachments,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedAttachment struct {
+	URL         string `json:"url"`
+	MimeType    string `json:"mime_type"`
+	SizeInBytes int64  `json:"size_in_bytes,omitempty"`
+}
+
+func (feed syndication) jsonFeed() ([]byte, error) {
+	document := jsonFeedDocument{
+		Version: "https://jsonfeed.org/version/1.1",
+		Title:   feed.Title,
+		FeedURL: feed.Link,
+		Items:   []jsonFeedItem{},
+	}
+
+	for _, entry := range feed.Entries {
+		item := jsonFeedItem{
+			ID:            entry.guid(),
+			URL:           entry.Link,
+			Title:         entry.Title,
+			ContentHTML:   entry.Content,
+			Summary:       entry.Summary,
+			DatePublished: entry.date().UTC().Format(time.RFC3339),
+			Tags:          entry.Categories,
+		}
+
+		if item.ContentHTML == "" {
+			item.ContentHTML = entry.Summary
+		}
+
+		if entry.Author != "" {
+			item.Authors = []jsonFeedAuthor{{Name: entry.Author}}
+		}
+
+		for _, enclosure := range entry.Enclosures {
+			item.Attachments = append(item.Attachments, jsonFeedAttachment{URL: enclosure.URL,
+				MimeType: enclosure.Type, SizeInBytes: enclosure.Length})
+		}
+
+		document.Items = append(document.Items, item)
+	}
+
+	return json.MarshalIndent(document, "", "  ")
+}
+
+// guid returns the id of the item if it is an absolute url. Other ids are
+// hashed together with the url of the feed into an urn.
+func (entry historyEntry) guid() string {
+	link, err := url.Parse(entry.ID)
+	if err == nil && link.IsAbs() {
+		return entry.ID
+	}
+
+	hash := sha256.Sum256([]byte(entry.FeedUrl + "\n" + entry.ID))
+	return "urn:sha256:" + hex.EncodeToString(hash[:])
+}
+
+// date returns the date of the item or the time it matched if the item has
+// no date.
+func (entry historyEntry) date() time.Time {
+	if entry.Date.IsZero() {
+		return entry.Matched
+	}
+
+	return entry.Date
+}
+
+func marshalXML(document interface{}) ([]byte, error) {
+	data, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), data...), nil
+}
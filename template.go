@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"html"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	rss "github.com/AlexanderThaller/rss-1"
+	"github.com/juju/errgo"
+)
+
+const (
+	DefaultTemplateSubject = `{{.Item.Title | trim}}`
+	DefaultTemplateText    = `{{if .Folder}}[{{.Folder}}] {{end}}{{.Feed.Title}} - {{.Item.Title | trim}}
+{{.Item.Link}}{{range .Item.Enclosures}}
+{{.URL}}{{end}}`
+	DefaultTemplateHTML = `{{.Feed.Title | replace "." "_"}} - {{.Item.Title | trim}}<br>
+{{.Item.Content}}<br>
+<a href="{{.Item.Link}}">Link</a>{{range .Item.Enclosures}}<br>
+<a href="{{.URL}}">{{.URL | base}}</a>{{if .Length}} ({{.Length | size}}){{end}}{{end}}`
+)
+
+// Templates are the text/template templates the notifications are generated
+// with. Subject is the subject of mails, Text the plain text body that is
+// also used for xmpp messages and HTML the html body of mails. Empty
+// templates of a feed fall back to the global ones and empty global ones to
+// the defaults.
+type Templates struct {
+	Subject string `json:",omitempty"`
+	Text    string `json:",omitempty"`
+	HTML    string `json:",omitempty"`
+}
+
+// messageTemplates are the compiled templates of a feed.
+type messageTemplates struct {
+	subject *template.Template
+	text    *template.Template
+	html    *template.Template
+}
+
+// messageData is what the templates are executed with.
+type messageData struct {
+	Feed    messageFeed
+	Item    *rss.Item
+	Filter  string
+	Filters []string
+	Folder  string
+	Date    time.Time
+}
+
+type messageFeed struct {
+	Title string
+	Url   string
+	Link  string
+}
+
+var htmlTags = regexp.MustCompile(`<[^>]*>`)
+
+var templateFuncs = template.FuncMap{
+	"trim":  strings.TrimSpace,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"replace": func(old, new, s string) string {
+		return strings.Replace(s, old, new, -1)
+	},
+	"join": func(sep string, values []string) string {
+		return strings.Join(values, sep)
+	},
+	"truncate": func(length int, s string) string {
+		runes := []rune(s)
+		if len(runes) <= length {
+			return s
+		}
+
+		return string(runes[:length]) + "…"
+	},
+	"date": func(layout string, date time.Time) string {
+		return date.Format(layout)
+	},
+	"stripHTML": func(s string) string {
+		return html.UnescapeString(htmlTags.ReplaceAllString(s, ""))
+	},
+	"base": func(s string) string {
+		parsed, err := url.Parse(s)
+		if err != nil || path.Base(parsed.Path) == "/" || path.Base(parsed.Path) == "." {
+			return s
+		}
+
+		return path.Base(parsed.Path)
+	},
+	"size": formatSize,
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+}
+
+// formatSize formats a number of bytes for humans.
+func formatSize(bytes int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+
+	size := float64(bytes)
+	unit := 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+
+	if unit == 0 {
+		return strconv.FormatInt(bytes, 10) + " B"
+	}
+
+	return strconv.FormatFloat(size, 'f', 1, 64) + " " + units[unit]
+}
+
+// compileTemplates compiles the templates of a feed over the global ones.
+// Every template is executed once with an example item so that unknown
+// fields and functions are found before the first item is sent.
+func compileTemplates(global Templates, feed *Templates) (*messageTemplates, error) {
+	merged := Templates{
+		Subject: DefaultTemplateSubject,
+		Text:    DefaultTemplateText,
+		HTML:    DefaultTemplateHTML,
+	}
+	for _, templates := range []*Templates{&global, feed} {
+		if templates == nil {
+			continue
+		}
+
+		if templates.Subject != "" {
+			merged.Subject = templates.Subject
+		}
+		if templates.Text != "" {
+			merged.Text = templates.Text
+		}
+		if templates.HTML != "" {
+			merged.HTML = templates.HTML
+		}
+	}
+
+	compiled := new(messageTemplates)
+	for _, entry := range []struct {
+		name   string
+		source string
+		out    **template.Template
+	}{
+		{"subject", merged.Subject, &compiled.subject},
+		{"text", merged.Text, &compiled.text},
+		{"html", merged.HTML, &compiled.html},
+	} {
+		parsed, err := compileTemplate(entry.name, entry.source)
+		if err != nil {
+			return nil, err
+		}
+
+		*entry.out = parsed
+	}
+
+	return compiled, nil
+}
+
+// compileTemplate parses the template and executes it once with an example
+// item.
+func compileTemplate(templateName, source string) (*template.Template, error) {
+	parsed, err := template.New(templateName).Funcs(templateFuncs).Parse(source)
+	if err != nil {
+		return nil, errgo.Notef(err, "can not parse %s template", templateName)
+	}
+
+	err = parsed.Execute(ioutil.Discard, exampleMessageData())
+	if err != nil {
+		return nil, errgo.Notef(err, "can not execute %s template", templateName)
+	}
+
+	return parsed, nil
+}
+
+// Validate checks that the templates can be compiled and executed.
+func (templates Templates) Validate() error {
+	_, err := compileTemplates(templates, nil)
+	return err
+}
+
+func exampleMessageData() messageData {
+	return messageData{
+		Feed: messageFeed{Title: "Feed", Url: "http://localhost/feed", Link: "http://localhost/"},
+		Item: &rss.Item{
+			Title:      "Item",
+			Summary:    "Summary",
+			Content:    "Content",
+			Link:       "http://localhost/item",
+			Date:       time.Now(),
+			ID:         "item",
+			Author:     "Author",
+			Categories: []string{"Category"},
+			Enclosures: []rss.Enclosure{
+				{URL: "http://localhost/item.mp3", Type: "audio/mpeg", Length: 1024},
+			},
+			Image:    "http://localhost/item.jpg",
+			Duration: time.Minute,
+		},
+		Filter:  "Filter",
+		Filters: []string{"Filter"},
+		Folder:  "folder",
+		Date:    time.Now(),
+	}
+}
+
+// execute runs the template and returns the output as a string.
+func execute(tmpl *template.Template, data messageData) (string, error) {
+	var buffer bytes.Buffer
+	err := tmpl.Execute(&buffer, data)
+	if err != nil {
+		return "", errgo.Notef(err, "can not execute %s template", tmpl.Name())
+	}
+
+	return buffer.String(), nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	rss "github.com/AlexanderThaller/rss-1"
+)
+
+func TestFeedTemplates(t *testing.T) {
+	item := &rss.Item{
+		Title:   " Go 1.5 released\n",
+		Content: "<p>Go &amp; more</p>",
+		Link:    "http://localhost/go",
+	}
+
+	tests := []struct {
+		global  Templates
+		feed    *Templates
+		subject string
+		body    string
+		xmpp    string
+	}{
+		{
+			Templates{}, nil,
+			"Go 1.5 released",
+			"http://localhost/feed - Go 1.5 released<br>\n<p>Go &amp; more</p><br>\n" +
+				`<a href="http://localhost/go">Link</a>`,
+			"[news] http://localhost/feed - Go 1.5 released\nhttp://localhost/go",
+		},
+		{
+			Templates{Subject: "[{{.Folder | upper}}] {{.Item.Title}}", Text: "{{.Item.Content | stripHTML}}"},
+			&Templates{Subject: "{{.Filter}}: {{.Item.Title | trim | truncate 5}}"},
+			"Go: Go 1.…",
+			`<a href="http://localhost/go">Link</a>`,
+			"Go & more",
+		},
+	}
+
+	for i, test := range tests {
+		conf := &Config{Templates: test.global}
+		feed := &Feed{Url: "http://localhost/feed"}
+		err := feed.Configure(Feed{
+			Url:       feed.Url,
+			Filters:   []Filter{{Expression: "Go"}},
+			Folder:    "news",
+			Templates: test.feed,
+		}, conf, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filtered := feed.Filter(item)
+		message, err := feed.GenerateMessage(filtered, "test@localhost")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		header, parts := readMessage(t, message.Bytes())
+		if header.Get("Subject") != test.subject {
+			t.Errorf("%d: expected subject %q but got %q", i, test.subject, header.Get("Subject"))
+		}
+
+		if !strings.Contains(parts["text/html"], test.body) {
+			t.Errorf("%d: expected %q in html part %q", i, test.body, parts["text/html"])
+		}
+
+		if parts["text/plain"] != test.xmpp {
+			t.Errorf("%d: expected text part %q but got %q", i, test.xmpp, parts["text/plain"])
+		}
+
+		xmpp, err := feed.GenerateXmppMessage(filtered)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if xmpp != test.xmpp {
+			t.Errorf("%d: expected xmpp message %q but got %q", i, test.xmpp, xmpp)
+		}
+	}
+}
+
+func TestTemplatesValidate(t *testing.T) {
+	tests := map[string]bool{
+		"": true,
+		"{{.Item.Title}} {{.Date | date \"2006\"}}": true,
+		"{{.Feed.Title | join \", \"}}":             false,
+		"{{.Item.Unknown}}":                         false,
+		"{{unknown .Item}}":                         false,
+		"{{.Item.Title":                             false,
+	}
+
+	for source, valid := range tests {
+		err := Templates{HTML: source}.Validate()
+		if (err == nil) != valid {
+			t.Errorf("%q: expected valid to be %v but got %v", source, valid, err)
+		}
+	}
+}
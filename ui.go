@@ -0,0 +1,197 @@
+package main
+
+// serverIndex is the web interface of the server. It only uses the http api
+// so everything it does can also be done with curl.
+const serverIndex = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="token" content="{{token}}">
+<title>RssWatch</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border-bottom: 1px solid #ddd; padding: 0.3em; text-align: left; vertical-align: top; }
+textarea, input[type=text] { width: 100%; box-sizing: border-box; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>RssWatch</h1>
+
+<h2>Feeds</h2>
+<table>
+<thead><tr><th>Url</th><th>Folder</th><th>Filters</th><th>Status</th><th></th></tr></thead>
+<tbody id="feeds"></tbody>
+</table>
+
+<h2 id="form-title">Add feed</h2>
+<form id="form">
+<p><label>Url <input type="text" name="url"></label></p>
+<p><label>Folder <input type="text" name="folder"></label></p>
+<p><label>Filters, one per line <textarea name="filters" rows="4"></textarea></label></p>
+<p><button type="submit">Save</button> <button type="button" id="cancel">Cancel</button></p>
+<p class="error" id="error"></p>
+</form>
+
+<h2>Recent matches</h2>
+<ul id="matches"></ul>
+
+<script>
+var editing = null;
+var token = document.querySelector("meta[name=token]").content;
+
+function api(method, path, body) {
+  return fetch(path, {
+    method: method,
+    headers: {"Content-Type": "application/json", "X-RssWatch-Token": token},
+    body: body === undefined ? undefined : JSON.stringify(body)
+  }).then(function(response) {
+    if (!response.ok) {
+      return response.text().then(function(text) { throw new Error(text); });
+    }
+    return response.status === 204 ? null : response.json();
+  });
+}
+
+function feedPath(action, url) {
+  return "/api/feed" + action + "?url=" + encodeURIComponent(url);
+}
+
+function cell(row, text) {
+  var td = document.createElement("td");
+  td.textContent = text;
+  row.appendChild(td);
+  return td;
+}
+
+function button(parent, text, action) {
+  var b = document.createElement("button");
+  b.textContent = text;
+  b.onclick = function() { action().then(load).catch(showError); };
+  parent.appendChild(b);
+}
+
+function filterText(filter) {
+  return typeof filter === "string" ? filter : JSON.stringify(filter);
+}
+
+// filters returns the filters of the feed as text, feeds without filters
+// have null as Filters.
+function filters(feed) {
+  return (feed.Filters || []).map(filterText).join("\n");
+}
+
+// safeLink returns the link if it is a http or https url. Links come from
+// the feeds and could otherwise run javascript.
+function safeLink(link) {
+  try {
+    var parsed = new URL(link);
+    if (parsed.protocol === "http:" || parsed.protocol === "https:") return parsed.href;
+  } catch (err) {}
+  return null;
+}
+
+function status(feed) {
+  if (feed.Paused) return "paused";
+  if (!feed.Running) return "stopped";
+  if (feed.Status.LastError) {
+    return "error (" + feed.Status.Failures + " in a row): " + feed.Status.LastError;
+  }
+  if (feed.Status.LastFetch.indexOf("0001-") === 0) return "waiting";
+  return "fetched " + new Date(feed.Status.LastFetch).toLocaleString();
+}
+
+function edit(feed) {
+  editing = feed;
+  var form = document.getElementById("form");
+  form.url.value = feed.Url;
+  form.folder.value = feed.Folder;
+  form.filters.value = filters(feed);
+  document.getElementById("form-title").textContent = "Edit feed";
+  return Promise.resolve();
+}
+
+function reset() {
+  editing = null;
+  document.getElementById("form").reset();
+  document.getElementById("form-title").textContent = "Add feed";
+  document.getElementById("error").textContent = "";
+}
+
+function showError(err) {
+  document.getElementById("error").textContent = err.message;
+}
+
+function load() {
+  api("GET", "/api/feeds").then(function(feeds) {
+    var body = document.getElementById("feeds");
+    body.innerHTML = "";
+    feeds.forEach(function(feed) {
+      var row = document.createElement("tr");
+      cell(row, feed.Url);
+      cell(row, feed.Folder);
+      cell(row, filters(feed)).style.whiteSpace = "pre";
+      cell(row, status(feed));
+      var actions = cell(row, "");
+      button(actions, "Edit", function() { return edit(feed); });
+      if (feed.Paused) {
+        button(actions, "Resume", function() { return api("POST", feedPath("/resume", feed.Url)); });
+      } else {
+        button(actions, "Pause", function() { return api("POST", feedPath("/pause", feed.Url)); });
+      }
+      button(actions, "Delete", function() {
+        if (!confirm("Delete " + feed.Url + "?")) return Promise.resolve();
+        return api("DELETE", feedPath("", feed.Url));
+      });
+      body.appendChild(row);
+    });
+  }).catch(showError);
+
+  api("GET", "/api/matches").then(function(matches) {
+    var list = document.getElementById("matches");
+    list.innerHTML = "";
+    matches.forEach(function(match) {
+      var item = document.createElement("li");
+      var href = safeLink(match.Link);
+      var link = document.createElement(href ? "a" : "span");
+      if (href) link.href = href;
+      link.textContent = match.Title;
+      item.appendChild(document.createTextNode(match.Feed + " (" + match.Filter + "): "));
+      item.appendChild(link);
+      list.appendChild(item);
+    });
+  }).catch(showError);
+}
+
+document.getElementById("cancel").onclick = reset;
+document.getElementById("form").onsubmit = function(event) {
+  event.preventDefault();
+  var form = event.target;
+  var feed = editing ? JSON.parse(JSON.stringify(editing)) : {};
+  delete feed.Running;
+  delete feed.Status;
+  delete feed.Matches;
+  feed.Url = form.url.value;
+  feed.Folder = form.folder.value;
+  feed.Filters = form.filters.value.split("\n").filter(function(line) {
+    return line.trim() !== "";
+  }).map(function(line) {
+    try {
+      var filter = JSON.parse(line);
+      if (typeof filter === "object") return filter;
+    } catch (e) {}
+    return line;
+  });
+
+  var request = editing ?
+    api("PUT", feedPath("", editing.Url), feed) :
+    api("POST", "/api/feeds", feed);
+  request.then(function() { reset(); load(); }).catch(showError);
+};
+
+load();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/AlexanderThaller/config"
+	"github.com/AlexanderThaller/logger"
+	"github.com/AlexanderThaller/service"
+	"github.com/juju/errgo"
+)
+
+// Watcher is the service that runs the notifiers and watches all feeds of
+// the configuration. On reload it will read the config file again and apply
+// the differences to the running feeds.
+type Watcher struct {
+	path      string
+	config    *Config
+	notifiers map[string]Notifier
+	feeds     map[string]*Feed
+	lock      sync.Mutex
+}
+
+func NewWatcher(path string, conf *Config) *Watcher {
+	watcher := new(Watcher)
+	watcher.path = path
+	watcher.config = conf
+	watcher.feeds = make(map[string]*Feed)
+
+	return watcher
+}
+
+func (watcher *Watcher) Start(messages chan<- service.Message) error {
+	watcher.lock.Lock()
+	defer watcher.lock.Unlock()
+
+	return watcher.apply(watcher.config)
+}
+
+func (watcher *Watcher) Stop() {
+	l := logger.New(name, "Watcher", "Stop")
+
+	watcher.lock.Lock()
+	defer watcher.lock.Unlock()
+
+	for url, feed := range watcher.feeds {
+		l.Debug("Stopping feed ", url)
+		feed.Stop()
+	}
+	watcher.feeds = make(map[string]*Feed)
+
+	for notifierName, notifier := range watcher.notifiers {
+		l.Debug("Stopping notifier ", notifierName)
+		notifier.Stop()
+	}
+	watcher.notifiers = nil
+}
+
+func (watcher *Watcher) Reload() {
+	l := logger.New(name, "Watcher", "Reload")
+	l.Notice("Reloading config from ", watcher.path)
+
+	conf, err := reconfigure(watcher.path)
+	if err != nil {
+		l.Error("Can not read config: ", errgo.Details(err))
+		return
+	}
+
+	err = setup(conf)
+	if err != nil {
+		l.Error("Can not setup environment: ", errgo.Details(err))
+		return
+	}
+
+	watcher.lock.Lock()
+	defer watcher.lock.Unlock()
+
+	err = watcher.apply(conf)
+	if err != nil {
+		l.Error("Can not apply config: ", errgo.Details(err))
+		return
+	}
+
+	l.Notice("Reloaded config")
+}
+
+// Feeds returns the configured feeds together with the status and the
+// recent matches of the ones that are running.
+func (watcher *Watcher) Feeds() []feedInfo {
+	watcher.lock.Lock()
+	defer watcher.lock.Unlock()
+
+	infos := make([]feedInfo, 0, len(watcher.config.Feeds))
+	for _, settings := range watcher.config.Feeds {
+		info := feedInfo{Feed: settings}
+
+		feed, running := watcher.feeds[settings.Url]
+		if running {
+			info.Running = true
+			info.Status = feed.Status()
+			info.Matches = feed.Recent()
+		}
+
+		infos = append(infos, info)
+	}
+
+	return infos
+}
+
+// HttpToken returns the api token of the current config.
+func (watcher *Watcher) HttpToken() string {
+	watcher.lock.Lock()
+	defer watcher.lock.Unlock()
+
+	return watcher.config.HttpToken
+}
+
+// History returns the matched items of all configured feeds that the given
+// function accepts, the newest first. At most HistorySize items are
+// returned. The history of feeds that are not running is read from the
+// DataFolder.
+func (watcher *Watcher) History(match func(entry historyEntry) bool) []historyEntry {
+	watcher.lock.Lock()
+	defer watcher.lock.Unlock()
+
+	var history []historyEntry
+	for _, settings := range watcher.config.Feeds {
+		var entries []historyEntry
+		if feed, running := watcher.feeds[settings.Url]; running {
+			entries = feed.History()
+		} else {
+			entries, _ = readHistory(settings.Filename(watcher.config.DataFolder))
+		}
+
+		for _, entry := range entries {
+			if match(entry) {
+				history = append(history, entry)
+			}
+		}
+	}
+	sort.Stable(historyByMatched(history))
+
+	size := watcher.config.HistorySize
+	if size <= 0 {
+		size = DefaultHistorySize
+	}
+
+	if len(history) > size {
+		history = history[:size]
+	}
+
+	return history
+}
+
+// Change will call the given function with a copy of the current config,
+// apply the changed config and save it to the config file. Comments in the
+// config file are kept. Changes the function makes to the feeds have to
+// replace the feed settings instead of modifying them in place.
+func (watcher *Watcher) Change(change func(conf *Config) error) error {
+	l := logger.New(name, "Watcher", "Change")
+
+	watcher.lock.Lock()
+	defer watcher.lock.Unlock()
+
+	conf := new(Config)
+	*conf = *watcher.config
+	conf.Feeds = append([]Feed{}, watcher.config.Feeds...)
+
+	err := change(conf)
+	if err != nil {
+		return err
+	}
+
+	err = watcher.apply(conf)
+	if err != nil {
+		return err
+	}
+
+	if watcher.path == "" {
+		return nil
+	}
+
+	l.Debug("Saving config to ", watcher.path)
+	return config.Update(watcher.path, conf)
+}
+
+// apply will restart the notifiers with the given config and start, stop or
+// reconfigure the feeds so they match the config. The data of feeds that
+// keep running is not touched.
+func (watcher *Watcher) apply(conf *Config) error {
+	l := logger.New(name, "Watcher", "apply")
+
+	l.Debug("Checking config")
+	wanted, err := validateConfig(conf)
+	if err != nil {
+		return err
+	}
+
+	// The old notifiers have to be stopped before the new ones are launched so
+	// the queues are never delivered by two notifiers at once. Items that are
+	// pushed in between will stay on disk until the new notifiers are running.
+	l.Debug("Restarting notifiers")
+	stopNotifiers(watcher.notifiers)
+	notifiers, err := launchNotifiers(conf)
+	if err != nil {
+		watcher.restoreNotifiers()
+		return err
+	}
+	watcher.notifiers = notifiers
+	watcher.config = conf
+
+	for url, feed := range watcher.feeds {
+		if _, exists := wanted[url]; exists {
+			continue
+		}
+
+		l.Info("Stopping removed or paused feed ", url)
+		feed.Stop()
+		delete(watcher.feeds, url)
+	}
+
+	for _, settings := range conf.Feeds {
+		if settings.Paused {
+			l.Debug("Feed is paused ", settings.Url)
+			continue
+		}
+
+		feed, exists := watcher.feeds[settings.Url]
+		if exists {
+			l.Debug("Reconfiguring feed ", settings.Url)
+			err := feed.Configure(settings, conf, notifiers)
+			if err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		l.Info("Starting new feed ", settings.Url)
+		feed = new(Feed)
+		*feed = settings
+		err := feed.Launch(conf, notifiers)
+		if err != nil {
+			return err
+		}
+
+		watcher.feeds[settings.Url] = feed
+	}
+
+	return nil
+}
+
+// restoreNotifiers launches the notifiers of the current config again after
+// the notifiers of a new config could not be launched. The running feeds are
+// routed to the restored notifiers.
+func (watcher *Watcher) restoreNotifiers() {
+	l := logger.New(name, "Watcher", "restoreNotifiers")
+
+	if watcher.notifiers == nil {
+		return
+	}
+
+	notifiers, err := launchNotifiers(watcher.config)
+	if err != nil {
+		l.Error("Can not restore notifiers: ", errgo.Details(err))
+		watcher.notifiers = nil
+		return
+	}
+	watcher.notifiers = notifiers
+
+	for _, settings := range watcher.config.Feeds {
+		feed, running := watcher.feeds[settings.Url]
+		if !running {
+			continue
+		}
+
+		err := feed.Configure(settings, watcher.config, notifiers)
+		if err != nil {
+			l.Warning("Can not reconfigure feed ", settings.Url, ": ", errgo.Details(err))
+		}
+	}
+}
+
+func stopNotifiers(notifiers map[string]Notifier) {
+	for _, notifier := range notifiers {
+		notifier.Stop()
+	}
+}
+
+// validateConfig checks the settings and feeds of the config and returns the
+// urls of the feeds that should be running.
+func validateConfig(conf *Config) (map[string]struct{}, error) {
+	err := conf.Catchup.Validate()
+	if err != nil {
+		return nil, errgo.Notef(err, "catchup")
+	}
+
+	err = validateFeedBackoff(conf)
+	if err != nil {
+		return nil, errgo.Notef(err, "feed backoff")
+	}
+
+	err = validatePrimaryFilter(conf.PrimaryFilter)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateMail(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateMailEnclosures(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	err = conf.Templates.Validate()
+	if err != nil {
+		return nil, errgo.Notef(err, "templates")
+	}
+
+	declared := declaredNotifiers(conf)
+	for notifierName, settings := range declared {
+		err = settings.Validate()
+		if err != nil {
+			return nil, errgo.Notef(err, "notifier %s", notifierName)
+		}
+	}
+
+	err = conf.GlobalFilters.Validate(declared)
+	if err != nil {
+		return nil, errgo.Notef(err, "global filters")
+	}
+
+	configured := make(map[string]struct{})
+	wanted := make(map[string]struct{})
+	for _, feed := range conf.Feeds {
+		if _, exists := configured[feed.Url]; exists {
+			return nil, errgo.New("feed " + feed.Url + " is configured more than once")
+		}
+		configured[feed.Url] = struct{}{}
+
+		err = feed.Validate(declared)
+		if err != nil {
+			return nil, errgo.Notef(err, "feed %s", feed.Url)
+		}
+
+		if !feed.Paused {
+			wanted[feed.Url] = struct{}{}
+		}
+	}
+
+	return wanted, nil
+}
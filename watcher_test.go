@@ -0,0 +1,182 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testFeedData = `<?xml version="1.0"?>
+<rss version="2.0">
+<channel>
+<title>Test</title>
+<link>http://localhost/</link>
+<description>Test feed</description>
+<item>
+<title>First item</title>
+<link>http://localhost/first</link>
+<guid>first</guid>
+<description>Content of the first item</description>
+</item>
+</channel>
+</rss>`
+
+func testFeedServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testFeedData))
+	}))
+}
+
+func TestWatcherApply(t *testing.T) {
+	server := testFeedServer()
+	defer server.Close()
+
+	folder, err := ioutil.TempDir("", "rsswatch-watcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	conf := &Config{
+		DataFolder: folder,
+		Notifiers: map[string]NotifierConfig{
+			"file": {Type: NotifierTypeFile, Path: filepath.Join(folder, "items")},
+		},
+		Feeds: []Feed{
+			{Url: server.URL + "/a", Filters: []Filter{{Expression: "First"}}},
+			{Url: server.URL + "/b", Filters: []Filter{{Expression: "First"}}},
+		},
+	}
+
+	watcher := NewWatcher("", conf)
+	err = watcher.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Stop()
+
+	kept := watcher.feeds[server.URL+"/b"]
+
+	reloaded := *conf
+	reloaded.Feeds = []Feed{
+		{Url: server.URL + "/b", Filters: []Filter{{Expression: "Second"}}, Folder: "changed"},
+		{Url: server.URL + "/c", Filters: []Filter{{Expression: "First"}}},
+	}
+
+	err = watcher.apply(&reloaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(watcher.feeds) != 2 {
+		t.Error("expected 2 feeds but got ", len(watcher.feeds))
+	}
+
+	if _, exists := watcher.feeds[server.URL+"/a"]; exists {
+		t.Error("removed feed is still running")
+	}
+
+	if _, exists := watcher.feeds[server.URL+"/c"]; !exists {
+		t.Error("new feed was not started")
+	}
+
+	if watcher.feeds[server.URL+"/b"] != kept {
+		t.Error("changed feed was restarted instead of reconfigured")
+	}
+
+	kept.lock.RLock()
+	_, exists := kept.filters["Second"]
+	folderName := kept.Folder
+	kept.lock.RUnlock()
+	if !exists || folderName != "changed" {
+		t.Error("changed feed was not reconfigured")
+	}
+
+	invalid := reloaded
+	invalid.Feeds = []Feed{{Url: server.URL + "/d", Filters: []Filter{{Expression: "("}}}}
+	err = watcher.apply(&invalid)
+	if err == nil {
+		t.Error("expected an error for an invalid filter")
+	}
+
+	if len(watcher.feeds) != 2 {
+		t.Error("invalid config changed the running feeds")
+	}
+}
+
+func TestWatcherNotifierErrors(t *testing.T) {
+	folder, err := ioutil.TempDir("", "rsswatch-watcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	items := filepath.Join(folder, "items")
+	conf := &Config{
+		DataFolder: folder,
+		Notifiers:  map[string]NotifierConfig{"file": {Type: NotifierTypeFile, Path: items}},
+	}
+
+	watcher := NewWatcher("", conf)
+	err = watcher.Start(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Stop()
+
+	err = watcher.Change(func(conf *Config) error {
+		conf.Notifiers = map[string]NotifierConfig{"hook": {Type: NotifierTypeWebhook}}
+		return nil
+	})
+	if err == nil {
+		t.Error("expected an error for a webhook without url")
+	}
+
+	// The queues can not be created below a file so launching the notifiers
+	// fails after the old ones were stopped.
+	err = ioutil.WriteFile(items, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = watcher.Change(func(conf *Config) error {
+		conf.DataFolder = items
+		return nil
+	})
+	if err == nil {
+		t.Error("expected an error for an unusable data folder")
+	}
+
+	if _, restored := watcher.notifiers["file"]; !restored {
+		t.Error("old notifiers were not restored: ", watcher.notifiers)
+	}
+
+	err = watcher.Change(func(conf *Config) error {
+		conf.Notifiers = map[string]NotifierConfig{"other": {Type: NotifierTypeFile, Path: items}}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notifier, ok := watcher.notifiers["other"].(*FileNotifier)
+	if !ok {
+		t.Fatal("notifiers were not replaced: ", watcher.notifiers)
+	}
+
+	err = notifier.queue.Push([]byte("delivered\n"))
+	if err == nil {
+		err = notifier.Drain()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := ioutil.ReadFile(items)
+	if string(data) != "delivered\n" {
+		t.Errorf("expected the restarted notifier to deliver but got %q", data)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/juju/errgo"
+)
+
+const (
+	// WebhookSignatureHeader holds the hex encoded hmac-sha256 of the body
+	// signed with the secret of the notifier, prefixed with sha256=.
+	WebhookSignatureHeader = "X-RssWatch-Signature"
+
+	DefaultWebhookTimeout = 10 * time.Second
+	// DefaultWebhookContentType is the content type of the json body and of
+	// templated bodies of notifiers without a content type.
+	DefaultWebhookContentType = "application/json"
+)
+
+// WebhookNotifier will post every item to an url. The body is the item as
+// json or the output of the template of the notifier.
+type WebhookNotifier struct {
+	template *template.Template
+	queue    *Queue
+}
+
+func launchWebhookNotifier(conf *Config, notifierName string, settings NotifierConfig) (*WebhookNotifier, error) {
+	timeout, err := parseDurationDefault(settings.Timeout, DefaultWebhookTimeout)
+	if err != nil {
+		return nil, errgo.Notef(err, "timeout of notifier %s", notifierName)
+	}
+
+	notifier := new(WebhookNotifier)
+	if settings.Template != "" {
+		notifier.template, err = compileTemplate(notifierName, settings.Template)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	client := &http.Client{Timeout: timeout}
+	contentType := webhookContentType(settings)
+	notifier.queue, err = launchQueue(conf, notifierName, func(payload []byte) error {
+		return postWebhook(client, settings, contentType, payload)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return notifier, nil
+}
+
+func (notifier *WebhookNotifier) Notify(item *Item) error {
+	data, _ := item.feed.messageData(item)
+
+	if notifier.template == nil {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+
+		return notifier.queue.Push(payload)
+	}
+
+	payload, err := execute(notifier.template, data)
+	if err != nil {
+		return err
+	}
+
+	return notifier.queue.Push([]byte(payload))
+}
+
+func (notifier *WebhookNotifier) Drain() error {
+	return notifier.queue.Drain()
+}
+
+func (notifier *WebhookNotifier) Stop() {
+	notifier.queue.Stop()
+}
+
+// webhookContentType returns the content type of the bodies of the
+// notifier. The configured content type only applies to templated bodies as
+// the built-in body is always json.
+func webhookContentType(settings NotifierConfig) string {
+	if settings.Template == "" || settings.ContentType == "" {
+		return DefaultWebhookContentType
+	}
+
+	return settings.ContentType
+}
+
+func validateWebhookContentType(contentType string) error {
+	if contentType == "" {
+		return nil
+	}
+
+	_, _, err := mime.ParseMediaType(contentType)
+	return err
+}
+
+// postWebhook sends the payload to the url of the notifier. Server errors
+// and too many requests are retried by the queue, all other failed responses
+// are permanent.
+func postWebhook(client *http.Client, settings NotifierConfig, contentType string, payload []byte) error {
+	req, err := http.NewRequest("POST", settings.Url, bytes.NewReader(payload))
+	if err != nil {
+		return &queueError{error: err, Permanent: true}
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", name)
+	if settings.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, signWebhook(settings.Secret, payload))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return nil
+
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		failure := &queueError{error: errgo.New("server returned " + resp.Status)}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			failure.RetryAfter = time.Duration(seconds) * time.Second
+		} else if date, err := http.ParseTime(resp.Header.Get("Retry-After")); err == nil {
+			failure.RetryAfter = date.Sub(time.Now())
+		}
+
+		return failure
+
+	default:
+		return &queueError{error: errgo.New("server returned " + resp.Status), Permanent: true}
+	}
+}
+
+func signWebhook(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	rss "github.com/AlexanderThaller/rss-1"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var lock sync.Mutex
+	requests := make(map[string]int)
+	contentTypes := make(map[string]string)
+	var bodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		lock.Lock()
+		defer lock.Unlock()
+
+		requests[r.URL.Path]++
+		contentTypes[r.URL.Path] = r.Header.Get("Content-Type")
+		switch {
+		case r.URL.Path == "/rejected":
+			w.WriteHeader(http.StatusBadRequest)
+		case r.URL.Path == "/signed" && r.Header.Get(WebhookSignatureHeader) != signWebhook("secret", body):
+			w.WriteHeader(http.StatusUnauthorized)
+		case requests[r.URL.Path] == 1:
+			w.WriteHeader(http.StatusInternalServerError)
+		case requests[r.URL.Path] == 2:
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			bodies = append(bodies, body)
+		}
+	}))
+	defer server.Close()
+
+	folder, err := ioutil.TempDir("", "rsswatch-webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	conf := &Config{
+		DataFolder:      folder,
+		QueueBackoffMin: "1ms",
+		QueueBackoffMax: "10ms",
+		Notifiers: map[string]NotifierConfig{
+			"signed": {Type: NotifierTypeWebhook, Url: server.URL + "/signed", Secret: "secret"},
+			"templated": {Type: NotifierTypeWebhook, Url: server.URL + "/templated",
+				Template: `{"text": {{printf "%s: %s" .Feed.Title .Item.Title | json}}}`},
+			"plain": {Type: NotifierTypeWebhook, Url: server.URL + "/plain",
+				Template: "{{.Item.Title}}", ContentType: "text/plain; charset=utf-8"},
+			"rejected": {Type: NotifierTypeWebhook, Url: server.URL + "/rejected"},
+		},
+	}
+
+	notifiers, err := launchNotifiers(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stopNotifiers(notifiers)
+
+	feed := &Feed{Url: "http://localhost/feed"}
+	err = feed.Configure(Feed{Url: feed.Url, Filters: []Filter{{Expression: "Go"}}}, conf, notifiers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	item := feed.Filter(&rss.Item{ID: "go", Title: "Go \"1.5\""})
+	for notifierName, notifier := range notifiers {
+		err = notifier.Notify(item)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Rejected webhooks are moved to the dead folder and reported.
+		err = notifier.Drain()
+		if (err != nil) != (notifierName == "rejected") {
+			t.Fatal(notifierName, ": ", err)
+		}
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if requests["/signed"] != 3 || requests["/templated"] != 3 || requests["/rejected"] != 1 {
+		t.Error("expected server errors to be retried and client errors not but got ", requests)
+	}
+
+	for path, contentType := range map[string]string{
+		"/signed":    "application/json",
+		"/templated": "application/json",
+		"/plain":     "text/plain; charset=utf-8",
+	} {
+		if contentTypes[path] != contentType {
+			t.Errorf("expected content type %q for %s but got %q", contentType, path, contentTypes[path])
+		}
+	}
+
+	if len(bodies) != 3 {
+		t.Fatal("expected three delivered webhooks but got ", len(bodies))
+	}
+
+	for _, body := range bodies {
+		if string(body) == "Go \"1.5\"" {
+			continue
+		}
+
+		var payload struct {
+			Text   string
+			Item   rss.Item
+			Filter string
+		}
+		err = json.Unmarshal(body, &payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if payload.Text != "http://localhost/feed: Go \"1.5\"" &&
+			(payload.Item.Title != "Go \"1.5\"" || payload.Filter != "Go") {
+			t.Errorf("got wrong payload %s", body)
+		}
+	}
+
+	dead, _ := notifiers["rejected"].(*WebhookNotifier).queue.Dead()
+	if len(dead) != 1 {
+		t.Error("expected the rejected webhook in the dead folder but got ", dead)
+	}
+}
+
+func TestWebhookNotifierConfig(t *testing.T) {
+	folder, err := ioutil.TempDir("", "rsswatch-webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(folder)
+
+	for _, settings := range []NotifierConfig{
+		{Type: NotifierTypeWebhook},
+		{Type: NotifierTypeWebhook, Url: "http://localhost", Timeout: "soon"},
+		{Type: NotifierTypeWebhook, Url: "http://localhost", Template: "{{.Unknown}}"},
+		{Type: NotifierTypeWebhook, Url: "http://localhost", Template: "{{.Item.Title}}", ContentType: "text/"},
+	} {
+		conf := &Config{DataFolder: folder, Notifiers: map[string]NotifierConfig{"hook": settings}}
+		notifiers, err := launchNotifiers(conf)
+		if err == nil {
+			stopNotifiers(notifiers)
+			t.Errorf("expected an error for %+v", settings)
+		}
+	}
+}
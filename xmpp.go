@@ -0,0 +1,458 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AlexanderThaller/logger"
+	"github.com/juju/errgo"
+)
+
+const (
+	DefaultXmppKeepAlive  = 1 * time.Minute
+	DefaultXmppTimeout    = 30 * time.Second
+	DefaultXmppBackoffMin = 1 * time.Second
+	DefaultXmppBackoffMax = 5 * time.Minute
+	DefaultXmppResource   = name
+
+	nsXmppStream  = "http://etherx.jabber.org/streams"
+	nsXmppTLS     = "urn:ietf:params:xml:ns:xmpp-tls"
+	nsXmppSASL    = "urn:ietf:params:xml:ns:xmpp-sasl"
+	nsXmppBind    = "urn:ietf:params:xml:ns:xmpp-bind"
+	nsXmppSession = "urn:ietf:params:xml:ns:xmpp-session"
+)
+
+type xmppFeatures struct {
+	XMLName    xml.Name        `xml:"http://etherx.jabber.org/streams features"`
+	StartTLS   *struct{}       `xml:"urn:ietf:params:xml:ns:xmpp-tls starttls"`
+	Mechanisms *xmppMechanisms `xml:"urn:ietf:params:xml:ns:xmpp-sasl mechanisms"`
+	Bind       *struct{}       `xml:"urn:ietf:params:xml:ns:xmpp-bind bind"`
+	Session    *struct{}       `xml:"urn:ietf:params:xml:ns:xmpp-session session"`
+}
+
+type xmppMechanisms struct {
+	Mechanism []string `xml:"mechanism"`
+}
+
+type xmppMessage struct {
+	XMLName xml.Name `xml:"message"`
+	To      string   `xml:"to,attr"`
+	Type    string   `xml:"type,attr"`
+	Body    string   `xml:"body"`
+}
+
+// XmppClient is a minimal xmpp client which is only able to authenticate
+// against a server and send chat messages to a destination.
+type XmppClient struct {
+	Domain    string
+	Password  string
+	Port      uint16
+	SkipTLS   bool
+	Username  string
+	KeepAlive time.Duration
+	TLSConfig *tls.Config
+
+	conn    net.Conn
+	decoder *xml.Decoder
+	dead    chan struct{}
+	lock    sync.Mutex
+	backoff time.Duration
+	retry   time.Time
+}
+
+func NewXmppClient(conf *Config) *XmppClient {
+	client := new(XmppClient)
+	client.Domain = conf.XmppDomain
+	client.Password = conf.XmppPassword
+	client.Port = conf.XmppPort
+	client.SkipTLS = conf.XmppSkipTLS
+	client.Username = conf.XmppUsername
+	client.KeepAlive = DefaultXmppKeepAlive
+
+	return client
+}
+
+// Send will deliver the given message. If the client is not connected it
+// will connect first. Failed connection attempts are retried with an
+// exponential backoff.
+func (client *XmppClient) Send(message xmppMessage) error {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+
+	if !client.connected() {
+		if time.Now().Before(client.retry) {
+			return errgo.New("not connected, will reconnect at " + client.retry.String())
+		}
+
+		err := client.connect()
+		if err != nil {
+			client.close()
+
+			client.backoff *= 2
+			if client.backoff < DefaultXmppBackoffMin {
+				client.backoff = DefaultXmppBackoffMin
+			}
+			if client.backoff > DefaultXmppBackoffMax {
+				client.backoff = DefaultXmppBackoffMax
+			}
+			client.retry = time.Now().Add(client.backoff)
+
+			return err
+		}
+
+		client.backoff = 0
+	}
+
+	data, err := xml.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return client.write(string(data))
+}
+
+// Close will end the current session if there is one.
+func (client *XmppClient) Close() {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+
+	client.close()
+}
+
+func (client *XmppClient) connected() bool {
+	if client.conn == nil {
+		return false
+	}
+
+	select {
+	case <-client.dead:
+		return false
+	default:
+		return true
+	}
+}
+
+func (client *XmppClient) close() {
+	if client.conn == nil {
+		return
+	}
+
+	client.conn.SetWriteDeadline(time.Now().Add(DefaultXmppTimeout))
+	io.WriteString(client.conn, "</stream:stream>")
+	client.conn.Close()
+	client.conn = nil
+}
+
+func (client *XmppClient) connect() error {
+	l := logger.New(name, "XmppClient", "connect", client.Domain)
+
+	// The connection of a dead session is still open.
+	client.close()
+
+	address := net.JoinHostPort(client.Domain, strconv.Itoa(int(client.Port)))
+	l.Debug("Connecting to ", address)
+	conn, err := net.DialTimeout("tcp", address, DefaultXmppTimeout)
+	if err != nil {
+		return err
+	}
+	client.conn = conn
+
+	features, err := client.openStream()
+	if err != nil {
+		return err
+	}
+
+	if !client.SkipTLS {
+		l.Debug("Starting tls")
+		err = client.startTLS(features)
+		if err != nil {
+			return err
+		}
+
+		features, err = client.openStream()
+		if err != nil {
+			return err
+		}
+	}
+
+	l.Debug("Authenticating as ", client.Username)
+	err = client.authenticate(features)
+	if err != nil {
+		return err
+	}
+
+	features, err = client.openStream()
+	if err != nil {
+		return err
+	}
+
+	l.Debug("Binding resource")
+	err = client.bind(features)
+	if err != nil {
+		return err
+	}
+
+	err = client.write("<presence/>")
+	if err != nil {
+		return err
+	}
+
+	client.dead = make(chan struct{})
+	go client.read(client.decoder, client.dead)
+	go client.keepAlive(client.conn, client.dead)
+
+	l.Debug("Connected")
+	return nil
+}
+
+func (client *XmppClient) openStream() (*xmppFeatures, error) {
+	header := "<?xml version='1.0'?><stream:stream to='" + xmlEscape(client.Domain) +
+		"' xmlns='jabber:client' xmlns:stream='" + nsXmppStream + "' version='1.0'>"
+
+	err := client.write(header)
+	if err != nil {
+		return nil, err
+	}
+
+	client.decoder = xml.NewDecoder(client.conn)
+	start, err := client.next()
+	if err != nil {
+		return nil, err
+	}
+
+	if start.Name.Space != nsXmppStream || start.Name.Local != "stream" {
+		return nil, errgo.New("expected stream header but got " + start.Name.Local)
+	}
+
+	start, err = client.next()
+	if err != nil {
+		return nil, err
+	}
+
+	features := new(xmppFeatures)
+	err = client.decoder.DecodeElement(features, &start)
+	if err != nil {
+		return nil, err
+	}
+
+	return features, nil
+}
+
+func (client *XmppClient) startTLS(features *xmppFeatures) error {
+	if features.StartTLS == nil {
+		return errgo.New("server does not offer starttls")
+	}
+
+	err := client.write("<starttls xmlns='" + nsXmppTLS + "'/>")
+	if err != nil {
+		return err
+	}
+
+	start, err := client.next()
+	if err != nil {
+		return err
+	}
+
+	if start.Name.Local != "proceed" {
+		return errgo.New("server refused starttls")
+	}
+
+	config := client.TLSConfig
+	if config == nil {
+		config = &tls.Config{ServerName: client.Domain}
+	}
+
+	conn := tls.Client(client.conn, config)
+	client.conn.SetDeadline(time.Now().Add(DefaultXmppTimeout))
+	err = conn.Handshake()
+	if err != nil {
+		return err
+	}
+	client.conn.SetDeadline(time.Time{})
+	client.conn = conn
+
+	return nil
+}
+
+func (client *XmppClient) authenticate(features *xmppFeatures) error {
+	plain := false
+	if features.Mechanisms != nil {
+		for _, mechanism := range features.Mechanisms.Mechanism {
+			if mechanism == "PLAIN" {
+				plain = true
+			}
+		}
+	}
+
+	if !plain {
+		return errgo.New("server does not offer the PLAIN sasl mechanism")
+	}
+
+	credentials := "\x00" + client.Username + "\x00" + client.Password
+	err := client.write("<auth xmlns='" + nsXmppSASL + "' mechanism='PLAIN'>" +
+		base64.StdEncoding.EncodeToString([]byte(credentials)) + "</auth>")
+	if err != nil {
+		return err
+	}
+
+	start, err := client.next()
+	if err != nil {
+		return err
+	}
+
+	if start.Name.Local != "success" {
+		return errgo.New("authentication failed: " + start.Name.Local)
+	}
+
+	return client.decoder.Skip()
+}
+
+func (client *XmppClient) bind(features *xmppFeatures) error {
+	if features.Bind == nil {
+		return errgo.New("server does not offer resource binding")
+	}
+
+	err := client.write("<iq type='set' id='bind_1'><bind xmlns='" + nsXmppBind +
+		"'><resource>" + DefaultXmppResource + "</resource></bind></iq>")
+	if err != nil {
+		return err
+	}
+
+	err = client.result("bind_1")
+	if err != nil {
+		return err
+	}
+
+	if features.Session == nil {
+		return nil
+	}
+
+	err = client.write("<iq type='set' id='session_1'><session xmlns='" +
+		nsXmppSession + "'/></iq>")
+	if err != nil {
+		return err
+	}
+
+	return client.result("session_1")
+}
+
+// result waits for the iq result with the given id.
+func (client *XmppClient) result(id string) error {
+	for {
+		start, err := client.next()
+		if err != nil {
+			return err
+		}
+
+		err = client.decoder.Skip()
+		if err != nil {
+			return err
+		}
+
+		if start.Name.Local != "iq" || xmlAttr(start, "id") != id {
+			continue
+		}
+
+		if xmlAttr(start, "type") != "result" {
+			return errgo.New("iq " + id + " failed")
+		}
+
+		return nil
+	}
+}
+
+// next returns the next start element from the stream.
+func (client *XmppClient) next() (xml.StartElement, error) {
+	client.conn.SetReadDeadline(time.Now().Add(DefaultXmppTimeout))
+	defer client.conn.SetReadDeadline(time.Time{})
+
+	for {
+		token, err := client.decoder.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			return token, nil
+		case xml.EndElement:
+			if token.Name.Local == "stream" {
+				return xml.StartElement{}, io.EOF
+			}
+		}
+	}
+}
+
+func (client *XmppClient) write(data string) error {
+	client.conn.SetWriteDeadline(time.Now().Add(DefaultXmppTimeout))
+	_, err := io.WriteString(client.conn, data)
+
+	return err
+}
+
+// read will consume everything the server sends us after the session was
+// established and closes dead when the connection breaks.
+func (client *XmppClient) read(decoder *xml.Decoder, dead chan struct{}) {
+	l := logger.New(name, "XmppClient", "read", client.Domain)
+	defer close(dead)
+
+	for {
+		_, err := decoder.Token()
+		if err != nil {
+			l.Debug("Connection closed: ", err)
+			return
+		}
+	}
+}
+
+// keepAlive will send whitespace pings to the server so the connection is
+// not closed because of inactivity.
+func (client *XmppClient) keepAlive(conn net.Conn, dead chan struct{}) {
+	l := logger.New(name, "XmppClient", "keepAlive", client.Domain)
+
+	for {
+		select {
+		case <-dead:
+			return
+		case <-time.After(client.KeepAlive):
+		}
+
+		client.lock.Lock()
+		if client.conn != conn {
+			client.lock.Unlock()
+			return
+		}
+
+		l.Trace("Sending whitespace ping")
+		err := client.write(" ")
+		if err != nil {
+			l.Debug("Can not send ping: ", err)
+			client.close()
+		}
+		client.lock.Unlock()
+	}
+}
+
+func xmlAttr(start xml.StartElement, name string) string {
+	for _, attr := range start.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+
+	return ""
+}
+
+func xmlEscape(data string) string {
+	buffer := bytes.NewBufferString("")
+	xml.EscapeText(buffer, []byte(data))
+
+	return buffer.String()
+}
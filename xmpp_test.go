@@ -0,0 +1,271 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// xmppServer is a minimal in-process xmpp server that accepts a single
+// client, authenticates it and forwards every received chat message.
+type xmppServer struct {
+	listener net.Listener
+	tls      *tls.Config
+	messages chan xmppMessage
+	errors   chan error
+}
+
+func newXmppServer(t *testing.T, tlsConfig *tls.Config) *xmppServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &xmppServer{
+		listener: listener,
+		tls:      tlsConfig,
+		messages: make(chan xmppMessage, 10),
+		errors:   make(chan error, 10),
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				err := server.serve(conn)
+				if err != nil && err != io.EOF {
+					server.errors <- err
+				}
+			}()
+		}
+	}()
+
+	return server
+}
+
+func (server *xmppServer) port() uint16 {
+	_, port, _ := net.SplitHostPort(server.listener.Addr().String())
+	value, _ := strconv.Atoi(port)
+
+	return uint16(value)
+}
+
+func (server *xmppServer) serve(conn net.Conn) error {
+	defer conn.Close()
+
+	mechanisms := "<mechanisms xmlns='" + nsXmppSASL + "'><mechanism>PLAIN</mechanism></mechanisms>"
+
+	feature := mechanisms
+	if server.tls != nil {
+		feature = "<starttls xmlns='" + nsXmppTLS + "'/>"
+	}
+
+	decoder, err := server.open(conn, feature)
+	if err != nil {
+		return err
+	}
+
+	if server.tls != nil {
+		if _, err = xmppNext(decoder); err != nil {
+			return err
+		}
+		io.WriteString(conn, "<proceed xmlns='"+nsXmppTLS+"'/>")
+
+		conn = tls.Server(conn, server.tls)
+		decoder, err = server.open(conn, mechanisms)
+		if err != nil {
+			return err
+		}
+	}
+
+	start, err := xmppNext(decoder)
+	if err != nil {
+		return err
+	}
+
+	var auth struct {
+		Mechanism string `xml:"mechanism,attr"`
+		Data      string `xml:",chardata"`
+	}
+	if err = decoder.DecodeElement(&auth, &start); err != nil {
+		return err
+	}
+
+	credentials, _ := base64.StdEncoding.DecodeString(auth.Data)
+	if auth.Mechanism != "PLAIN" || string(credentials) != "\x00test\x00secret" {
+		io.WriteString(conn, "<failure xmlns='"+nsXmppSASL+"'><not-authorized/></failure>")
+		return nil
+	}
+	io.WriteString(conn, "<success xmlns='"+nsXmppSASL+"'/>")
+
+	decoder, err = server.open(conn, "<bind xmlns='"+nsXmppBind+"'/>")
+	if err != nil {
+		return err
+	}
+
+	for {
+		start, err := xmppNext(decoder)
+		if err != nil {
+			return err
+		}
+
+		switch start.Name.Local {
+		case "iq":
+			decoder.Skip()
+			io.WriteString(conn, "<iq type='result' id='"+xmlAttr(start, "id")+
+				"'><bind xmlns='"+nsXmppBind+"'><jid>test@localhost/"+
+				DefaultXmppResource+"</jid></bind></iq>")
+		case "message":
+			var message xmppMessage
+			if err = decoder.DecodeElement(&message, &start); err != nil {
+				return err
+			}
+			server.messages <- message
+		default:
+			decoder.Skip()
+		}
+	}
+}
+
+// open waits for the stream header of the client and answers with a stream
+// header that offers the given feature.
+func (server *xmppServer) open(conn net.Conn, feature string) (*xml.Decoder, error) {
+	decoder := xml.NewDecoder(conn)
+	if _, err := xmppNext(decoder); err != nil {
+		return nil, err
+	}
+
+	io.WriteString(conn, "<?xml version='1.0'?><stream:stream from='localhost' "+
+		"xmlns='jabber:client' xmlns:stream='"+nsXmppStream+"' version='1.0'>"+
+		"<stream:features>"+feature+"</stream:features>")
+
+	return decoder, nil
+}
+
+func xmppNext(decoder *xml.Decoder) (xml.StartElement, error) {
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+
+		if start, ok := token.(xml.StartElement); ok {
+			return start, nil
+		}
+	}
+}
+
+func TestXmppClientSend(t *testing.T) {
+	serverTLS, pool := testCertificate(t)
+
+	tests := map[string]bool{
+		"skiptls":  true,
+		"starttls": false,
+	}
+
+	for test, skip := range tests {
+		var config *tls.Config
+		if !skip {
+			config = serverTLS
+		}
+
+		server := newXmppServer(t, config)
+		defer server.listener.Close()
+
+		client := &XmppClient{
+			Domain:    "localhost",
+			Password:  "secret",
+			Port:      server.port(),
+			SkipTLS:   skip,
+			Username:  "test",
+			KeepAlive: DefaultXmppKeepAlive,
+			TLSConfig: &tls.Config{ServerName: "localhost", RootCAs: pool},
+		}
+
+		for _, body := range []string{"first <message>", "second"} {
+			err := client.Send(xmppMessage{To: "admin@localhost", Type: "chat", Body: body})
+			if err != nil {
+				t.Fatal(test, ": can not send message: ", err)
+			}
+
+			select {
+			case message := <-server.messages:
+				if message.Body != body || message.To != "admin@localhost" {
+					t.Error(test, ": got wrong message: ", message)
+				}
+			case err := <-server.errors:
+				t.Fatal(test, ": server error: ", err)
+			case <-time.After(5 * time.Second):
+				t.Fatal(test, ": timeout while waiting for message")
+			}
+		}
+
+		client.Close()
+	}
+}
+
+func TestXmppClientAuthenticationFailure(t *testing.T) {
+	server := newXmppServer(t, nil)
+	defer server.listener.Close()
+
+	client := &XmppClient{
+		Domain:   "localhost",
+		Password: "wrong",
+		Port:     server.port(),
+		SkipTLS:  true,
+		Username: "test",
+	}
+
+	err := client.Send(xmppMessage{To: "admin@localhost", Type: "chat", Body: "message"})
+	if err == nil {
+		t.Error("expected an authentication error")
+	}
+}
+
+func TestXmppClientReconnectClose(t *testing.T) {
+	server := newXmppServer(t, nil)
+	defer server.listener.Close()
+
+	old, other := net.Pipe()
+	closed := make(chan struct{})
+	go func() {
+		ioutil.ReadAll(other)
+		close(closed)
+	}()
+
+	client := &XmppClient{
+		Domain:    "localhost",
+		Password:  "secret",
+		Port:      server.port(),
+		SkipTLS:   true,
+		Username:  "test",
+		KeepAlive: DefaultXmppKeepAlive,
+	}
+	defer client.Close()
+
+	// The old session is dead but its connection is still open.
+	client.conn = old
+	client.dead = make(chan struct{})
+	close(client.dead)
+
+	err := client.Send(xmppMessage{To: "admin@localhost", Type: "chat", Body: "message"})
+	if err != nil {
+		t.Fatal("can not send message: ", err)
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Error("the connection of the dead session was not closed")
+	}
+}